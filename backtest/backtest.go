@@ -2,13 +2,16 @@ package backtest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 
 	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/book"
 	"github.com/WinPooh32/retrade/candle"
 	"github.com/WinPooh32/retrade/platform"
-	"github.com/WinPooh32/retrade/ring/ringmapf64"
 	"github.com/WinPooh32/series"
 )
 
@@ -24,9 +27,17 @@ type HistorySnaphsot struct {
 	BestAsk candle.HistoryFloat32
 	BestBid candle.HistoryFloat32
 
+	// Book series are built of depth events, depth is summed
+	// within Options.BookDistance from the mid price.
+	BookImbalance candle.HistoryFloat32
+	BidDepth      candle.HistoryFloat32
+	AskDepth      candle.HistoryFloat32
+
 	VolumeClusters []map[float64]float64
 }
 
+const defaultBookDistance = 0.01
+
 type Strategy interface {
 	Name() string
 	BuySignal(snap HistorySnaphsot) bool
@@ -34,97 +45,277 @@ type Strategy interface {
 }
 
 type Options struct {
-	Symbol            platform.Symbol
-	FeeBuy            float32
-	FeeSell           float32
-	Account           float32
+	Symbol platform.Symbol
+	// Market of Symbol, it is derived from Symbol by the known quote
+	// assets if it is zero, e.g. BTCUSDT is traded as BTC for USDT.
+	Market  Market
+	Account float32
+	// FeeBuy and FeeSell are fractions charged by the exchange simulated
+	// for a provider which is not a Matcher, it starts with Account
+	// of the quote asset.
+	FeeBuy  float32
+	FeeSell float32
+
 	FramePeriod       int64
 	HistoryWindowSize int64
 	Limit             float32
+
+	// BookDistance is a fraction of the mid price to sum the order book
+	// depth within, 0.01 if zero.
+	BookDistance float64
+
+	// Start is the time in milliseconds when trading starts.
+	// Earlier events only warm up the history.
+	Start int64
+
+	// Markets are traded together with Symbol from the same wallet.
+	// Equity is valued in the quote asset of Market.
+	Markets map[platform.Symbol]Market
+}
+
+// ErrNoMarket is returned if the market of a symbol is not set
+// and can't be derived from the symbol.
+var ErrNoMarket = fmt.Errorf("unknown market of symbol")
+
+// quoteAssets are known quote assets to derive markets from symbols.
+var quoteAssets = []platform.Symbol{"USDT", "BUSD", "USDC", "TUSD", "FDUSD", "DAI", "BTC", "ETH", "BNB", "EUR", "TRY"}
+
+// marketOf derives the market of the symbol by the known quote assets.
+func marketOf(symbol platform.Symbol) (Market, bool) {
+	for _, quote := range quoteAssets {
+		if base := strings.TrimSuffix(string(symbol), string(quote)); base != "" && base != string(symbol) {
+			return Market{Base: platform.Symbol(base), Quote: quote}, true
+		}
+	}
+	return Market{}, false
+}
+
+// withMarkets sets markets derived from the symbols if they are zero.
+func (opt Options) withMarkets() (Options, error) {
+	if opt.Market == (Market{}) {
+		market, ok := marketOf(opt.Symbol)
+		if !ok {
+			return opt, fmt.Errorf("%w: symbol=%s", ErrNoMarket, opt.Symbol)
+		}
+		opt.Market = market
+	}
+	if opt.Market.Base == "" || opt.Market.Quote == "" {
+		return opt, fmt.Errorf("%w: symbol=%s: incomplete market %+v", ErrNoMarket, opt.Symbol, opt.Market)
+	}
+
+	markets := make(map[platform.Symbol]Market, len(opt.Markets))
+	for symbol, market := range opt.Markets {
+		if market == (Market{}) {
+			var ok bool
+			if market, ok = marketOf(symbol); !ok {
+				return opt, fmt.Errorf("%w: symbol=%s", ErrNoMarket, symbol)
+			}
+		}
+		markets[symbol] = market
+	}
+	opt.Markets = markets
+
+	return opt, nil
+}
+
+// Symbols returns Symbol followed by the other symbols of Markets.
+func (opt Options) Symbols() []platform.Symbol {
+	var symbols = []platform.Symbol{opt.Symbol}
+
+	for symbol := range opt.Markets {
+		if symbol != opt.Symbol {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	sort.Slice(symbols[1:], func(i, j int) bool {
+		return symbols[1+i] < symbols[1+j]
+	})
+
+	return symbols
+}
+
+func (opt Options) markets() map[platform.Symbol]Market {
+	markets := make(map[platform.Symbol]Market, len(opt.Markets)+1)
+	for symbol, market := range opt.Markets {
+		markets[symbol] = market
+	}
+	markets[opt.Symbol] = opt.Market
+	return markets
 }
 
 type Result struct {
+	Equity series.Data
+	// Account is the quote asset balance of the wallet after every sell.
+	// It is the whole balance including profits moved to Pool by Limit,
+	// unlike the account of the signal strategy alone it used to be.
 	Account series.Data
 	Buy     series.Data
 	Sell    series.Data
 	Pool    float32
+	Report  Report
+	Ledger  *Ledger
 }
 
-const (
-	buy  = 0
-	sell = 1
-)
-
 type Provider interface {
 	platform.Public
 	platform.Spot
 	platform.Account
 }
 
+// Matcher is a provider which simulates execution of orders.
+type Matcher interface {
+	Match(symbol platform.Symbol, event platform.EventContainer) error
+	Fills() []Fill
+	Balances() map[platform.Symbol]platform.Fixed
+}
+
+type simulator interface {
+	Provider
+	Matcher
+}
+
 type eventHandler struct {
-	opt    Options
-	runner *Runner
-	state  runstate
+	opt   Options
+	state runstate
 }
 
 type stats struct {
-	buyTime   []int64
-	buyPrice  []float32
-	sellTime  []int64
-	sellPrice []float32
-	account   []float32
+	start  int64
+	end    int64
+	ledger *Ledger
+
+	accountTime []int64
+	account     []float32
+
+	equityTime []int64
+	equity     []float32
+}
+
+func makeStats() stats {
+	const defaultCap = 1024
+	return stats{
+		ledger:      NewLedger(),
+		accountTime: make([]int64, 0, defaultCap),
+		account:     make([]float32, 0, defaultCap),
+		equityTime:  make([]int64, 0, defaultCap),
+		equity:      make([]float32, 0, defaultCap),
+	}
 }
 
 type Runner struct {
 	provider Provider
 	stats    stats
+	// exchange executes orders of the current run.
+	exchange simulator
 }
 
 func NewRunner(provider Provider) *Runner {
-	const defaultCap = 1024
 	return &Runner{
 		provider: provider,
-		stats: stats{
-			buyTime:   make([]int64, 0, defaultCap),
-			buyPrice:  make([]float32, 0, defaultCap),
-			sellTime:  make([]int64, 0, defaultCap),
-			sellPrice: make([]float32, 0, defaultCap),
-			account:   make([]float32, 0, defaultCap),
-		},
+		stats:    makeStats(),
 	}
 }
 
 func (runner *Runner) Run(ctx context.Context, strategy Strategy, opt Options) (result Result, err error) {
-	var handler = eventHandler{
-		opt:    opt,
-		runner: runner,
-		state: runstate{
-			side:    buy,
-			account: opt.Account,
-			pool:    0.0,
-
-			price:          candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-			buyBestCount:   candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-			sellBestCount:  candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-			buyBestVolume:  candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-			sellBestVolume: candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-			bestAsk:        candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-			bestBid:        candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
-
-			volumeClusters:       ringmapf64.MakeRing(int(opt.HistoryWindowSize)),
-			volumeClustersMoment: map[float64]float64{},
-
-			clusters: make([]map[float64]float64, 0, int(opt.HistoryWindowSize)),
-		},
+	var adapter = NewSignalStrategy(strategy, opt)
+
+	result, err = runner.Execute(ctx, adapter, opt)
+	if err != nil {
+		return result, err
 	}
 
-	for event := range runner.provider.Subscribe(ctx, opt.Symbol) {
-		var err error
+	result.Pool = adapter.Pool()
 
-		switch event.Type {
-		case platform.EventErr:
-			err = fmt.Errorf("provider: event: %w", event.Error)
+	return result, nil
+}
+
+func (runner *Runner) Execute(ctx context.Context, strategy OrderStrategy, opt Options) (result Result, err error) {
+	if opt, err = opt.withMarkets(); err != nil {
+		return result, err
+	}
+
+	runner.stats = makeStats()
+	runner.exchange = runner.simulate(opt)
+
+	var (
+		symbols  = opt.Symbols()
+		markets  = opt.markets()
+		handlers = make(map[platform.Symbol]*eventHandler, len(symbols))
+		sources  = make([]source, 0, len(symbols))
+	)
+
+	for _, symbol := range symbols {
+		handlers[symbol] = &eventHandler{
+			opt:   opt,
+			state: makeRunstate(opt),
+		}
+		sources = append(sources, source{
+			symbol: symbol,
+			events: runner.exchange.Subscribe(ctx, symbol),
+		})
+	}
+
+	var (
+		stream       = newMerger(sources)
+		finishedTick int64
+		lastTime     int64
+		pending      bool
+	)
+
+	flush := func() error {
+		for _, handler := range handlers {
+			if handler.state.tick > finishedTick {
+				finishedTick = handler.state.tick
+			}
+		}
+		pending = false
 
+		if err := runner.step(ctx, handlers, markets, lastTime, strategy, opt); err != nil {
+			return fmt.Errorf("strategy %s: %w", strategy.Name(), err)
+		}
+
+		if lastTime < opt.Start {
+			return nil
+		}
+
+		if err := runner.record(ctx, runner.exchange.Fills(), opt); err != nil {
+			return fmt.Errorf("record fills: %w", err)
+		}
+
+		if err := runner.mark(ctx, handlers, lastTime, opt); err != nil {
+			return fmt.Errorf("mark to market: %w", err)
+		}
+
+		return nil
+	}
+
+	for {
+		symbol, event, ok := stream.next()
+		if !ok {
+			break
+		}
+
+		if event.Type == platform.EventErr {
+			return result, fmt.Errorf("provider: symbol=%s: event: %w", symbol, event.Error)
+		}
+
+		// Frame is handed to the strategy when all events
+		// of the same timestamp are received.
+		if pending && event.Time() > lastTime {
+			if err = flush(); err != nil {
+				return result, err
+			}
+		}
+		lastTime = event.Time()
+
+		var handler = handlers[symbol]
+
+		if err = runner.exchange.Match(symbol, event); err != nil {
+			return result, fmt.Errorf("matcher: %w", err)
+		}
+
+		switch event.Type {
 		case platform.EventCandle:
 			if err = handler.onCandle(ctx, event.Event.Candle); err != nil {
 				err = fmt.Errorf("handler: on Candle event: %w", err)
@@ -139,64 +330,158 @@ func (runner *Runner) Run(ctx context.Context, strategy Strategy, opt Options) (
 			if err = handler.onBookTicker(ctx, event.Event.BookTicker); err != nil {
 				err = fmt.Errorf("handler: on Book Ticker event: %w", err)
 			}
+
+		case platform.EventDepth:
+			if err = handler.onDepth(ctx, event.Event.Depth); err != nil {
+				err = fmt.Errorf("handler: on Depth event: %w", err)
+			}
 		}
 
 		if err != nil {
 			return result, err
 		}
 
-		if state := &handler.state; state.next && state.tick > state.finishedTick {
-			runner.DoSideAction(state, strategy, opt)
+		if lastTime >= opt.Start {
+			if runner.stats.start == 0 {
+				runner.stats.start = lastTime
+			}
+			runner.stats.end = lastTime
+		}
+
+		if state := &handler.state; state.next && state.tick > finishedTick {
+			pending = true
+		}
+
+		if err = runner.record(ctx, runner.exchange.Fills(), opt); err != nil {
+			return result, fmt.Errorf("record fills: %w", err)
 		}
 	}
 
+	if pending {
+		if err = flush(); err != nil {
+			return result, err
+		}
+	}
+
+	var ledger = runner.stats.ledger
+	var equity = series.MakeData(1, runner.stats.equityTime, runner.stats.equity)
+
 	result = Result{
-		Buy:     series.MakeData(1, runner.stats.buyTime, runner.stats.buyPrice),
-		Sell:    series.MakeData(1, runner.stats.sellTime, runner.stats.sellPrice),
-		Account: series.MakeData(1, runner.stats.sellTime, runner.stats.account),
-		Pool:    handler.state.pool,
+		Equity:  equity,
+		Buy:     ledger.Prices(platform.OrderSideBuy),
+		Sell:    ledger.Prices(platform.OrderSideSell),
+		Account: series.MakeData(1, runner.stats.accountTime, runner.stats.account),
+		Report:  NewReport(ledger, equity, runner.stats.start, runner.stats.end),
+		Ledger:  ledger,
 	}
 
 	return result, nil
 }
 
-func (runner *Runner) DoSideAction(state *runstate, strategy Strategy, opt Options) {
-	state.finishedTick = state.tick
+// simulate returns the provider if it executes orders by itself,
+// otherwise orders are executed by an Exchange on top of its events.
+func (runner *Runner) simulate(opt Options) simulator {
+	if ex, ok := runner.provider.(simulator); ok {
+		return ex
+	}
 
-	state.volumeClusters.ForcePushBack(state.volumeClustersMoment)
-	n := state.volumeClusters.CopyTo(state.clusters[:state.volumeClusters.Len()])
+	return NewExchange(runner.provider, ExchangeOptions{
+		Markets: opt.markets(),
+		Wallet: map[platform.Symbol]platform.Fixed{
+			opt.Market.Quote: fixed.NewF(float64(opt.Account)),
+		},
+		FeeBuy:  fixed.NewF(float64(opt.FeeBuy)),
+		FeeSell: fixed.NewF(float64(opt.FeeSell)),
+	})
+}
 
-	state.volumeClustersMoment = map[float64]float64{}
+func (runner *Runner) step(ctx context.Context, handlers map[platform.Symbol]*eventHandler, markets map[platform.Symbol]Market, ts int64, strategy OrderStrategy, opt Options) error {
+	var snapshots = make(map[platform.Symbol]HistorySnaphsot, len(handlers))
 
-	var snap = HistorySnaphsot{
-		Price:          state.price.HistoryFloat32(),
-		BuyBestCount:   state.buyBestCount.HistoryFloat32(),
-		BuyBestVolume:  state.buyBestVolume.HistoryFloat32(),
-		SellBestCount:  state.sellBestCount.HistoryFloat32(),
-		SellBestVolume: state.sellBestVolume.HistoryFloat32(),
-		BestAsk:        state.bestAsk.HistoryFloat32(),
-		BestBid:        state.bestBid.HistoryFloat32(),
-		VolumeClusters: state.clusters[:n],
+	for symbol, handler := range handlers {
+		snapshots[symbol] = handler.state.snapshot()
 	}
 
-	switch state.side {
-	case buy:
-		var ts, price, ok = state.doBuy(strategy, snap, opt)
-		if ok {
-			runner.stats.buyTime = append(runner.stats.buyTime, ts)
-			runner.stats.buyPrice = append(runner.stats.buyPrice, price)
+	if ts < opt.Start {
+		return nil
+	}
+
+	var sc = StrategyContext{
+		Symbol:    opt.Symbol,
+		Market:    opt.Market,
+		Time:      ts,
+		Spot:      runner.exchange,
+		Account:   runner.exchange,
+		Snapshot:  snapshots[opt.Symbol],
+		Snapshots: snapshots,
+		Markets:   markets,
+	}
+
+	return strategy.Next(ctx, sc)
+}
+
+func (runner *Runner) record(ctx context.Context, fills []Fill, opt Options) error {
+	var sells []int64
+
+	for _, f := range fills {
+		runner.stats.ledger.Record(f)
+
+		if f.Side == platform.OrderSideSell {
+			sells = append(sells, f.Time)
 		}
-	case sell:
-		var ts, price, account, ok = state.doSell(strategy, snap, opt)
-		if ok {
-			runner.stats.sellTime = append(runner.stats.sellTime, ts)
-			runner.stats.sellPrice = append(runner.stats.sellPrice, price)
-			runner.stats.account = append(runner.stats.account, account)
+	}
+
+	if len(sells) == 0 {
+		return nil
+	}
+
+	wallet, err := runner.exchange.Wallet(ctx)
+	if err != nil {
+		return fmt.Errorf("wallet: %w", err)
+	}
+
+	account := float32(wallet[opt.Market.Quote].Float())
+
+	for _, ts := range sells {
+		runner.stats.accountTime = append(runner.stats.accountTime, ts)
+		runner.stats.account = append(runner.stats.account, account)
+	}
+
+	return nil
+}
+
+// mark records value of the account with open positions valued at
+// current close prices. Only markets quoted in the quote asset
+// of Options.Market are valued.
+func (runner *Runner) mark(ctx context.Context, handlers map[platform.Symbol]*eventHandler, ts int64, opt Options) error {
+	var (
+		balances = runner.exchange.Balances()
+		quote    = opt.Market.Quote
+		equity   = balances[quote]
+		valued   = map[platform.Symbol]bool{quote: true}
+	)
+
+	for symbol, market := range opt.markets() {
+		if market.Quote != quote || valued[market.Base] {
+			continue
 		}
+		valued[market.Base] = true
+
+		_, _, _, _, closePrice, _ := handlers[symbol].state.price.Last()
+		equity = equity.Add(balances[market.Base].Mul(closePrice))
 	}
+
+	runner.stats.equityTime = append(runner.stats.equityTime, ts)
+	runner.stats.equity = append(runner.stats.equity, float32(equity.Float()))
+
+	return nil
 }
 
 func (handler *eventHandler) onCandle(ctx context.Context, candle platform.Candle) error {
+	if candle.Partial {
+		return nil
+	}
+
 	state := &handler.state
 
 	state.price.AppendRaw(
@@ -207,6 +492,7 @@ func (handler *eventHandler) onCandle(ctx context.Context, candle platform.Candl
 		candle.Close,
 		candle.Volume,
 	)
+	state.time = candle.Time
 	state.tick = candle.Time / handler.opt.FramePeriod
 	state.next = true
 
@@ -216,6 +502,7 @@ func (handler *eventHandler) onCandle(ctx context.Context, candle platform.Candl
 func (handler *eventHandler) onTrade(ctx context.Context, trade platform.Trade) error {
 	state := &handler.state
 
+	state.time = trade.Time
 	state.tick = trade.Time / handler.opt.FramePeriod
 
 	var (
@@ -282,6 +569,7 @@ func (handler *eventHandler) onTrade(ctx context.Context, trade platform.Trade)
 func (handler *eventHandler) onBookTicker(ctx context.Context, bookticker platform.BookTicker) error {
 	state := &handler.state
 
+	state.time = bookticker.Time
 	state.tick = bookticker.Time / handler.opt.FramePeriod
 
 	state.bestAsk.Add(platform.Trade{
@@ -298,3 +586,46 @@ func (handler *eventHandler) onBookTicker(ctx context.Context, bookticker platfo
 
 	return nil
 }
+
+func (handler *eventHandler) onDepth(ctx context.Context, depth platform.Depth) error {
+	state := &handler.state
+
+	state.time = depth.Time
+	state.tick = depth.Time / handler.opt.FramePeriod
+
+	err := state.book.Apply(depth)
+	if errors.Is(err, book.ErrGap) || errors.Is(err, book.ErrNotSynced) {
+		// Wait for the next snapshot.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	distance := handler.opt.BookDistance
+	if distance == 0 {
+		distance = defaultBookDistance
+	}
+
+	bid, ask := state.book.Depth(distance)
+
+	state.bidDepth.Add(platform.Trade{
+		Time:     depth.Time,
+		Price:    bid,
+		Quantity: fixed.ZERO,
+	})
+
+	state.askDepth.Add(platform.Trade{
+		Time:     depth.Time,
+		Price:    ask,
+		Quantity: fixed.ZERO,
+	})
+
+	state.next = state.bookImbalance.Add(platform.Trade{
+		Time:     depth.Time,
+		Price:    fixed.NewF(state.book.Imbalance(distance)),
+		Quantity: fixed.ZERO,
+	})
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+// candles provides public candles only, orders are not executed by it.
+type candles struct {
+	NopProvider
+	closes []string
+}
+
+func (c *candles) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, len(c.closes))
+	for i, s := range c.closes {
+		price := fixed.NewS(s)
+		events <- platform.MakeCandle(platform.Candle{
+			Time:   int64(i + 1),
+			Open:   price,
+			High:   price,
+			Low:    price,
+			Close:  price,
+			Volume: fixed.NewI(1, 0),
+		})
+	}
+	close(events)
+	return events
+}
+
+// flip buys and sells on every frame.
+type flip struct{}
+
+func (flip) Name() string                         { return "flip" }
+func (flip) BuySignal(snap HistorySnaphsot) bool  { return true }
+func (flip) SellSignal(snap HistorySnaphsot) bool { return true }
+
+func testOptions() Options {
+	return Options{
+		Symbol:            testSymbol,
+		Market:            Market{Base: "BTC", Quote: "USDT"},
+		Account:           1000,
+		FramePeriod:       1,
+		HistoryWindowSize: 16,
+	}
+}
+
+func TestRunSimulatesNonMatcher(t *testing.T) {
+	var (
+		provider = &candles{closes: []string{"100", "110", "100", "110", "100"}}
+		opt      = testOptions()
+	)
+
+	opt.FeeBuy = 0.01
+	opt.FeeSell = 0.02
+
+	runner := NewRunner(provider)
+
+	result, err := runner.Run(context.Background(), flip{}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Report.RoundTrips != 2 {
+		t.Fatalf("round trips = %d, want 2", result.Report.RoundTrips)
+	}
+
+	fills := result.Ledger.Fills
+	if len(fills) != 5 {
+		t.Fatalf("fills = %d, want 5", len(fills))
+	}
+
+	// Fees are charged by side.
+	assertFixed(t, "buy fee", fills[0].Fee, "0.1")
+	assertFixed(t, "sell fee", fills[1].Fee, "21.78")
+
+	if n := len(result.Account.Data()); n != 2 {
+		t.Errorf("account points = %d, want 2", n)
+	}
+
+	// Every run starts with a fresh wallet.
+	again, err := runner.Run(context.Background(), flip{}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Report.TotalReturn != result.Report.TotalReturn {
+		t.Errorf("second run return = %v, want %v", again.Report.TotalReturn, result.Report.TotalReturn)
+	}
+}
+
+func TestRunAccountLimitedByWallet(t *testing.T) {
+	var (
+		provider = &candles{closes: []string{"100", "110", "100"}}
+		opt      = testOptions()
+	)
+
+	ex := NewExchange(provider, ExchangeOptions{
+		Markets: map[platform.Symbol]Market{testSymbol: opt.Market},
+		Wallet:  map[platform.Symbol]platform.Fixed{"USDT": fixed.NewI(500, 0)},
+	})
+
+	result, err := NewRunner(ex).Run(context.Background(), flip{}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fills := result.Ledger.Fills
+	if len(fills) == 0 {
+		t.Fatal("no fills")
+	}
+	assertFixed(t, "bought", fills[0].Quantity, "5")
+}
+
+func TestRunDerivesMarket(t *testing.T) {
+	var (
+		provider = &candles{closes: []string{"100", "110", "100"}}
+		opt      = testOptions()
+	)
+
+	// Only Symbol and Account are set like before markets were introduced.
+	opt.Market = Market{}
+
+	result, err := NewRunner(provider).Run(context.Background(), flip{}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fills := result.Ledger.Fills
+	if len(fills) != 3 {
+		t.Fatalf("fills = %d, want 3", len(fills))
+	}
+	assertFixed(t, "bought", fills[0].Quantity, "10")
+	assertFixed(t, "sold", fills[1].Quantity, "10")
+
+	if data := result.Account.Data(); len(data) != 1 || data[0] != 1100 {
+		t.Errorf("account = %v, want [1100]", data)
+	}
+}
+
+func TestRunUnknownMarket(t *testing.T) {
+	var (
+		provider = &candles{closes: []string{"100"}}
+		opt      = testOptions()
+	)
+
+	opt.Symbol = "FOOBAR"
+	opt.Market = Market{}
+
+	_, err := NewRunner(provider).Run(context.Background(), flip{}, opt)
+	if !errors.Is(err, ErrNoMarket) {
+		t.Fatalf("err = %v, want %v", err, ErrNoMarket)
+	}
+
+	opt.Market = Market{Base: "FOO"}
+
+	_, err = NewRunner(provider).Run(context.Background(), flip{}, opt)
+	if !errors.Is(err, ErrNoMarket) {
+		t.Fatalf("incomplete market: err = %v, want %v", err, ErrNoMarket)
+	}
+}
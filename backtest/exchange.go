@@ -0,0 +1,623 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/WinPooh32/retrade/platform"
+)
+
+var (
+	ErrUnknownSymbol       = fmt.Errorf("unknown symbol")
+	ErrUnknownOrder        = fmt.Errorf("unknown order")
+	ErrNoPrice             = fmt.Errorf("no market price")
+	ErrInvalidQuantity     = fmt.Errorf("invalid quantity")
+	ErrInsufficientBalance = fmt.Errorf("insufficient balance")
+)
+
+type Market struct {
+	Base  platform.Symbol
+	Quote platform.Symbol
+}
+
+type ExchangeOptions struct {
+	Markets  map[platform.Symbol]Market
+	Wallet   map[platform.Symbol]platform.Fixed
+	FeeMaker platform.Fixed
+	FeeTaker platform.Fixed
+	// FeeBuy and FeeSell override maker and taker fees of the side if not zero.
+	FeeBuy  platform.Fixed
+	FeeSell platform.Fixed
+}
+
+type Fill struct {
+	OrderID  string
+	Symbol   platform.Symbol
+	Side     platform.OrderSide
+	Type     platform.OrderType
+	Time     int64
+	Price    platform.Fixed
+	Quantity platform.Fixed
+	Fee      platform.Fixed
+	FeeAsset platform.Symbol
+}
+
+type quote struct {
+	time int64
+	last platform.Fixed
+	bid  platform.Fixed
+	ask  platform.Fixed
+}
+
+type span struct {
+	low  platform.Fixed
+	high platform.Fixed
+}
+
+type order struct {
+	id        string
+	symbol    platform.Symbol
+	market    Market
+	side      platform.OrderSide
+	typ       platform.OrderType
+	price     platform.Fixed
+	stop      platform.Fixed
+	quantity  platform.Fixed
+	time      int64
+	open      bool
+	triggered bool
+	status    platform.Status
+	executed  platform.Fixed
+	cost      platform.Fixed
+
+	lockAsset  platform.Symbol
+	lockAmount platform.Fixed
+
+	sibling *order
+}
+
+// Exchange simulates a spot exchange on top of a public event stream.
+// Orders are matched by Match, which Runner calls for every received event
+// before the strategy sees it, so fills never look ahead of the stream.
+type Exchange struct {
+	public platform.Public
+	opt    ExchangeOptions
+
+	mu     sync.Mutex
+	nextID int64
+	free   map[platform.Symbol]platform.Fixed
+	locked map[platform.Symbol]platform.Fixed
+	quotes map[platform.Symbol]*quote
+	orders []*order
+	fills  []Fill
+	// closed orders by id.
+	closed map[string]*order
+}
+
+var _ Provider = &Exchange{}
+var _ Matcher = &Exchange{}
+
+func NewExchange(public platform.Public, opt ExchangeOptions) *Exchange {
+	ex := &Exchange{
+		public: public,
+		opt:    opt,
+		free:   make(map[platform.Symbol]platform.Fixed, len(opt.Wallet)),
+		locked: map[platform.Symbol]platform.Fixed{},
+		quotes: map[platform.Symbol]*quote{},
+		closed: map[string]*order{},
+	}
+	for asset, value := range opt.Wallet {
+		ex.free[asset] = value
+	}
+	return ex
+}
+
+func (ex *Exchange) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	return ex.public.Subscribe(ctx, symbol)
+}
+
+func (ex *Exchange) Match(symbol platform.Symbol, event platform.EventContainer) error {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	q := ex.quote(symbol)
+
+	var buy, sell span
+
+	switch event.Type {
+	case platform.EventTrade:
+		t := event.Event.Trade
+		q.time = t.Time
+		q.last = t.Price
+		buy = span{t.Price, t.Price}
+		sell = buy
+
+	case platform.EventCandle:
+		c := event.Event.Candle
+		q.time = c.Time
+		q.last = c.Close
+		buy = span{c.Low, c.High}
+		sell = buy
+
+	case platform.EventBookTicker:
+		b := event.Event.BookTicker
+		q.time = b.Time
+		q.bid = b.BestBidPrice
+		q.ask = b.BestAskPrice
+		buy = span{b.BestAskPrice, b.BestAskPrice}
+		sell = span{b.BestBidPrice, b.BestBidPrice}
+
+	default:
+		return nil
+	}
+
+	ex.match(symbol, buy, sell, q.time)
+
+	return nil
+}
+
+// Fills returns fills executed since the previous call.
+func (ex *Exchange) Fills() []Fill {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	fills := ex.fills
+	ex.fills = nil
+	return fills
+}
+
+// Balances returns free and locked funds together.
+func (ex *Exchange) Balances() map[platform.Symbol]platform.Fixed {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	balances := make(map[platform.Symbol]platform.Fixed, len(ex.free))
+	for asset, value := range ex.free {
+		balances[asset] = value
+	}
+	for asset, value := range ex.locked {
+		balances[asset] = balances[asset].Add(value)
+	}
+
+	return balances
+}
+
+// OrderMarket fills immediately at the best known price. As on Binance,
+// quantity of a buy order is denominated in the quote asset.
+func (ex *Exchange) OrderMarket(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, quantity platform.Fixed) (orderID string, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	market, err := ex.market(symbol)
+	if err != nil {
+		return "", err
+	}
+	if quantity.Sign() <= 0 {
+		return "", fmt.Errorf("quantity=%s: %w", quantity, ErrInvalidQuantity)
+	}
+
+	q := ex.quote(symbol)
+	price := ex.marketPrice(q, side)
+	if price.IsZero() {
+		return "", fmt.Errorf("symbol=%s: %w", symbol, ErrNoPrice)
+	}
+
+	o := &order{
+		id:     ex.newID(),
+		symbol: symbol,
+		market: market,
+		side:   side,
+		typ:    platform.OrderTypeMarket,
+		time:   q.time,
+		open:   true,
+		status: platform.StatusNew,
+	}
+
+	switch side {
+	case platform.OrderSideBuy:
+		if ex.free[market.Quote].LessThan(quantity) {
+			return "", fmt.Errorf("%s: %w", market.Quote, ErrInsufficientBalance)
+		}
+		o.quantity = quantity.Div(price)
+		ex.settle(o, price, quantity, ex.opt.FeeTaker)
+
+	case platform.OrderSideSell:
+		if ex.free[market.Base].LessThan(quantity) {
+			return "", fmt.Errorf("%s: %w", market.Base, ErrInsufficientBalance)
+		}
+		o.quantity = quantity
+		ex.settle(o, price, price.Mul(quantity), ex.opt.FeeTaker)
+
+	default:
+		return "", fmt.Errorf("unexpected order side: %s", side)
+	}
+
+	o.open = false
+	ex.closed[o.id] = o
+
+	return o.id, nil
+}
+
+func (ex *Exchange) OrderLimit(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, price, quantity platform.Fixed) (orderID string, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	market, err := ex.market(symbol)
+	if err != nil {
+		return "", err
+	}
+	if quantity.Sign() <= 0 {
+		return "", fmt.Errorf("quantity=%s: %w", quantity, ErrInvalidQuantity)
+	}
+
+	q := ex.quote(symbol)
+
+	o := &order{
+		id:       ex.newID(),
+		symbol:   symbol,
+		market:   market,
+		side:     side,
+		typ:      platform.OrderTypeLimit,
+		price:    price,
+		quantity: quantity,
+		time:     q.time,
+		open:     true,
+		status:   platform.StatusNew,
+	}
+
+	if err = ex.lock(o, price); err != nil {
+		return "", err
+	}
+
+	// Marketable limit order is executed immediately as a taker.
+	if current := ex.marketPrice(q, side); !current.IsZero() && crosses(side, current, price) {
+		ex.release(o, platform.StatusFilled)
+		ex.settle(o, current, current.Mul(quantity), ex.opt.FeeTaker)
+		return o.id, nil
+	}
+
+	ex.orders = append(ex.orders, o)
+
+	return o.id, nil
+}
+
+func (ex *Exchange) OrderOCO(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, opt platform.OptionsOCO) (orderID string, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	market, err := ex.market(symbol)
+	if err != nil {
+		return "", err
+	}
+	if opt.Quantity.Sign() <= 0 {
+		return "", fmt.Errorf("quantity=%s: %w", opt.Quantity, ErrInvalidQuantity)
+	}
+
+	q := ex.quote(symbol)
+
+	stop := &order{
+		id:       ex.newID(),
+		symbol:   symbol,
+		market:   market,
+		side:     side,
+		typ:      platform.OrderTypeStopLossLimit,
+		price:    opt.Limit,
+		stop:     opt.Stop,
+		quantity: opt.Quantity,
+		time:     q.time,
+		open:     true,
+		status:   platform.StatusNew,
+	}
+
+	limit := &order{
+		id:       ex.newID(),
+		symbol:   symbol,
+		market:   market,
+		side:     side,
+		typ:      platform.OrderTypeLimitMaker,
+		price:    opt.Price,
+		quantity: opt.Quantity,
+		time:     q.time,
+		open:     true,
+		status:   platform.StatusNew,
+		sibling:  stop,
+	}
+	stop.sibling = limit
+
+	// Both legs share the funds, so they are locked once by the limit leg
+	// at the worst of the two prices.
+	lockPrice := opt.Price
+	if opt.Limit.GreaterThan(lockPrice) {
+		lockPrice = opt.Limit
+	}
+	if err = ex.lock(limit, lockPrice); err != nil {
+		return "", err
+	}
+
+	ex.orders = append(ex.orders, stop, limit)
+
+	return stop.id, nil
+}
+
+func (ex *Exchange) Cancel(ctx context.Context, symbol platform.Symbol, orderID string) (status string, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	for _, o := range ex.orders {
+		if o.symbol == symbol && o.id == orderID {
+			ex.release(o, platform.StatusCanceled)
+			return platform.StatusCanceled, nil
+		}
+	}
+
+	return "", fmt.Errorf("order=%s: %w", orderID, ErrUnknownOrder)
+}
+
+func (ex *Exchange) CancelAll(ctx context.Context, symbol platform.Symbol) (err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	for _, o := range ex.openOrders(symbol) {
+		if o.open {
+			ex.release(o, platform.StatusCanceled)
+		}
+	}
+
+	return nil
+}
+
+// QueryOrder returns the open or closed order.
+func (ex *Exchange) QueryOrder(ctx context.Context, symbol platform.Symbol, orderID string) (order platform.Order, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	for _, o := range ex.orders {
+		if o.symbol == symbol && o.id == orderID {
+			return o.order(), nil
+		}
+	}
+
+	if o, ok := ex.closed[orderID]; ok && o.symbol == symbol {
+		return o.order(), nil
+	}
+
+	return order, fmt.Errorf("order=%s: %w", orderID, ErrUnknownOrder)
+}
+
+func (ex *Exchange) ListOrders(ctx context.Context, symbol platform.Symbol) (orders []platform.Order, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	open := ex.openOrders(symbol)
+
+	orders = make([]platform.Order, 0, len(open))
+	for _, o := range open {
+		orders = append(orders, o.order())
+	}
+
+	return orders, nil
+}
+
+func (ex *Exchange) Wallet(ctx context.Context) (wallet map[platform.Symbol]platform.Fixed, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	wallet = make(map[platform.Symbol]platform.Fixed, len(ex.free))
+	for asset, value := range ex.free {
+		wallet[asset] = value
+	}
+
+	return wallet, nil
+}
+
+func (ex *Exchange) match(symbol platform.Symbol, buy, sell span, ts int64) {
+	open := ex.openOrders(symbol)
+
+	// Stop legs go first: when both OCO legs are reachable within
+	// the same event, the pessimistic outcome is assumed.
+	for _, o := range open {
+		if !o.open || o.typ != platform.OrderTypeStopLossLimit || o.triggered {
+			continue
+		}
+		switch o.side {
+		case platform.OrderSideBuy:
+			o.triggered = buy.high.GreaterThanOrEqual(o.stop)
+		case platform.OrderSideSell:
+			o.triggered = sell.low.LessThanOrEqual(o.stop)
+		}
+		if o.triggered {
+			ex.fillResting(o, buy, sell, ts, ex.opt.FeeTaker)
+		}
+	}
+
+	// Triggered stop legs rest in the book as limit orders.
+	for _, o := range open {
+		if !o.open || (o.typ == platform.OrderTypeStopLossLimit && !o.triggered) {
+			continue
+		}
+		ex.fillResting(o, buy, sell, ts, ex.opt.FeeMaker)
+	}
+}
+
+func (ex *Exchange) fillResting(o *order, buy, sell span, ts int64, fee platform.Fixed) {
+	var filled bool
+
+	switch o.side {
+	case platform.OrderSideBuy:
+		filled = buy.low.LessThanOrEqual(o.price)
+	case platform.OrderSideSell:
+		filled = sell.high.GreaterThanOrEqual(o.price)
+	}
+
+	if !filled {
+		return
+	}
+
+	o.time = ts
+	ex.release(o, platform.StatusFilled)
+	ex.settle(o, o.price, o.price.Mul(o.quantity), fee)
+}
+
+// settle moves funds of the executed order. Cost is the quote amount
+// paid or received before the fee.
+func (ex *Exchange) settle(o *order, price, cost, feeRate platform.Fixed) {
+	var fee platform.Fixed
+	var feeAsset platform.Symbol
+
+	switch o.side {
+	case platform.OrderSideBuy:
+		if !ex.opt.FeeBuy.IsZero() {
+			feeRate = ex.opt.FeeBuy
+		}
+		fee = o.quantity.Mul(feeRate)
+		feeAsset = o.market.Base
+		ex.free[o.market.Quote] = ex.free[o.market.Quote].Sub(cost)
+		ex.free[o.market.Base] = ex.free[o.market.Base].Add(o.quantity.Sub(fee))
+
+	case platform.OrderSideSell:
+		if !ex.opt.FeeSell.IsZero() {
+			feeRate = ex.opt.FeeSell
+		}
+		fee = cost.Mul(feeRate)
+		feeAsset = o.market.Quote
+		ex.free[o.market.Base] = ex.free[o.market.Base].Sub(o.quantity)
+		ex.free[o.market.Quote] = ex.free[o.market.Quote].Add(cost.Sub(fee))
+	}
+
+	o.status = platform.StatusFilled
+	o.executed = o.quantity
+	o.cost = cost
+
+	ex.fills = append(ex.fills, Fill{
+		OrderID:  o.id,
+		Symbol:   o.symbol,
+		Side:     o.side,
+		Type:     o.typ,
+		Time:     o.time,
+		Price:    price,
+		Quantity: o.quantity,
+		Fee:      fee,
+		FeeAsset: feeAsset,
+	})
+}
+
+func (ex *Exchange) lock(o *order, price platform.Fixed) error {
+	switch o.side {
+	case platform.OrderSideBuy:
+		o.lockAsset = o.market.Quote
+		o.lockAmount = price.Mul(o.quantity)
+	case platform.OrderSideSell:
+		o.lockAsset = o.market.Base
+		o.lockAmount = o.quantity
+	default:
+		return fmt.Errorf("unexpected order side: %s", o.side)
+	}
+
+	if ex.free[o.lockAsset].LessThan(o.lockAmount) {
+		return fmt.Errorf("%s: %w", o.lockAsset, ErrInsufficientBalance)
+	}
+
+	ex.free[o.lockAsset] = ex.free[o.lockAsset].Sub(o.lockAmount)
+	ex.locked[o.lockAsset] = ex.locked[o.lockAsset].Add(o.lockAmount)
+
+	return nil
+}
+
+// release closes the order with the status together with its OCO sibling,
+// which is canceled, and unlocks their funds.
+func (ex *Exchange) release(o *order, status platform.Status) {
+	for _, o := range []*order{o, o.sibling} {
+		if o == nil || !o.open {
+			continue
+		}
+		o.open = false
+		o.status = status
+		status = platform.StatusCanceled
+		ex.closed[o.id] = o
+
+		if o.lockAsset != "" {
+			ex.locked[o.lockAsset] = ex.locked[o.lockAsset].Sub(o.lockAmount)
+			ex.free[o.lockAsset] = ex.free[o.lockAsset].Add(o.lockAmount)
+		}
+	}
+
+	var n int
+	for _, o := range ex.orders {
+		if o.open {
+			ex.orders[n] = o
+			n++
+		}
+	}
+	ex.orders = ex.orders[:n]
+}
+
+func (o *order) order() platform.Order {
+	return platform.Order{
+		Symbol:                   string(o.symbol),
+		OrderID:                  o.id,
+		Price:                    o.price.String(),
+		OrigQuantity:             o.quantity.String(),
+		ExecutedQuantity:         o.executed.String(),
+		CummulativeQuoteQuantity: o.cost.String(),
+		Status:                   string(o.status),
+		Type:                     string(o.typ),
+		Side:                     string(o.side),
+		StopPrice:                o.stop.String(),
+		Time:                     o.time,
+	}
+}
+
+func (ex *Exchange) openOrders(symbol platform.Symbol) []*order {
+	var orders []*order
+	for _, o := range ex.orders {
+		if o.symbol == symbol {
+			orders = append(orders, o)
+		}
+	}
+	return orders
+}
+
+func (ex *Exchange) market(symbol platform.Symbol) (Market, error) {
+	market, ok := ex.opt.Markets[symbol]
+	if !ok {
+		return market, fmt.Errorf("symbol=%s: %w", symbol, ErrUnknownSymbol)
+	}
+	return market, nil
+}
+
+func (ex *Exchange) quote(symbol platform.Symbol) *quote {
+	q, ok := ex.quotes[symbol]
+	if !ok {
+		q = &quote{}
+		ex.quotes[symbol] = q
+	}
+	return q
+}
+
+func (ex *Exchange) marketPrice(q *quote, side platform.OrderSide) platform.Fixed {
+	switch {
+	case side == platform.OrderSideBuy && !q.ask.IsZero():
+		return q.ask
+	case side == platform.OrderSideSell && !q.bid.IsZero():
+		return q.bid
+	default:
+		return q.last
+	}
+}
+
+func (ex *Exchange) newID() string {
+	ex.nextID++
+	return strconv.FormatInt(ex.nextID, 10)
+}
+
+func crosses(side platform.OrderSide, current, price platform.Fixed) bool {
+	switch side {
+	case platform.OrderSideBuy:
+		return current.LessThanOrEqual(price)
+	case platform.OrderSideSell:
+		return current.GreaterThanOrEqual(price)
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+const testSymbol platform.Symbol = "BTCUSDT"
+
+func newTestExchange(t *testing.T, wallet map[platform.Symbol]platform.Fixed) *Exchange {
+	t.Helper()
+	return NewExchange(&NopProvider{}, ExchangeOptions{
+		Markets:  map[platform.Symbol]Market{testSymbol: {Base: "BTC", Quote: "USDT"}},
+		Wallet:   wallet,
+		FeeMaker: fixed.NewS("0.001"),
+		FeeTaker: fixed.NewS("0.002"),
+	})
+}
+
+func trade(t *testing.T, ex *Exchange, ts int64, price string) {
+	t.Helper()
+	err := ex.Match(testSymbol, platform.MakeTrade(platform.Trade{Time: ts, Price: fixed.NewS(price)}))
+	if err != nil {
+		t.Fatalf("match: %v", err)
+	}
+}
+
+func assertFixed(t *testing.T, name string, got platform.Fixed, want string) {
+	t.Helper()
+	if !got.Equal(fixed.NewS(want)) {
+		t.Errorf("%s = %s, want %s", name, got, want)
+	}
+}
+
+func assertStatus(t *testing.T, ex *Exchange, orderID string, want platform.Status) platform.Order {
+	t.Helper()
+	o, err := ex.QueryOrder(context.Background(), testSymbol, orderID)
+	if err != nil {
+		t.Fatalf("query order=%s: %v", orderID, err)
+	}
+	if o.Status != string(want) {
+		t.Errorf("order=%s status = %s, want %s", orderID, o.Status, want)
+	}
+	return o
+}
+
+func TestExchangeMarket(t *testing.T) {
+	ctx := context.Background()
+	ex := newTestExchange(t, map[platform.Symbol]platform.Fixed{"USDT": fixed.NewI(1000, 0)})
+
+	if _, err := ex.OrderMarket(ctx, testSymbol, platform.OrderSideBuy, fixed.NewI(100, 0)); !errors.Is(err, ErrNoPrice) {
+		t.Fatalf("order without price: err = %v, want %v", err, ErrNoPrice)
+	}
+
+	trade(t, ex, 1, "100")
+
+	// Quantity of a market buy is in the quote asset.
+	id, err := ex.OrderMarket(ctx, testSymbol, platform.OrderSideBuy, fixed.NewI(500, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, ex, id, platform.StatusFilled)
+
+	wallet, _ := ex.Wallet(ctx)
+	assertFixed(t, "USDT", wallet["USDT"], "500")
+	assertFixed(t, "BTC", wallet["BTC"], "4.99")
+
+	trade(t, ex, 2, "110")
+
+	id, err = ex.OrderMarket(ctx, testSymbol, platform.OrderSideSell, fixed.NewI(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, ex, id, platform.StatusFilled)
+
+	wallet, _ = ex.Wallet(ctx)
+	assertFixed(t, "USDT", wallet["USDT"], "719.56")
+	assertFixed(t, "BTC", wallet["BTC"], "2.99")
+
+	if _, err := ex.OrderMarket(ctx, testSymbol, platform.OrderSideSell, fixed.NewI(3, 0)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("oversized sell: err = %v, want %v", err, ErrInsufficientBalance)
+	}
+
+	fills := ex.Fills()
+	if len(fills) != 2 {
+		t.Fatalf("fills = %d, want 2", len(fills))
+	}
+	assertFixed(t, "buy fee", fills[0].Fee, "0.01")
+	assertFixed(t, "sell fee", fills[1].Fee, "0.44")
+}
+
+func TestExchangeLimit(t *testing.T) {
+	ctx := context.Background()
+	ex := newTestExchange(t, map[platform.Symbol]platform.Fixed{"USDT": fixed.NewI(1000, 0)})
+
+	trade(t, ex, 1, "100")
+
+	id, err := ex.OrderLimit(ctx, testSymbol, platform.OrderSideBuy, fixed.NewI(90, 0), fixed.NewI(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, ex, id, platform.StatusNew)
+
+	// Funds of the resting order are locked.
+	wallet, _ := ex.Wallet(ctx)
+	assertFixed(t, "free USDT", wallet["USDT"], "100")
+
+	trade(t, ex, 2, "95")
+	assertStatus(t, ex, id, platform.StatusNew)
+
+	trade(t, ex, 3, "89")
+	o := assertStatus(t, ex, id, platform.StatusFilled)
+	if o.Time != 3 {
+		t.Errorf("fill time = %d, want 3", o.Time)
+	}
+
+	wallet, _ = ex.Wallet(ctx)
+	assertFixed(t, "USDT", wallet["USDT"], "100")
+	assertFixed(t, "BTC", wallet["BTC"], "9.99")
+
+	fills := ex.Fills()
+	if len(fills) != 1 {
+		t.Fatalf("fills = %d, want 1", len(fills))
+	}
+	// Resting orders are filled at their price as makers.
+	assertFixed(t, "price", fills[0].Price, "90")
+	assertFixed(t, "fee", fills[0].Fee, "0.01")
+}
+
+func TestExchangeMarketableLimit(t *testing.T) {
+	ctx := context.Background()
+	ex := newTestExchange(t, map[platform.Symbol]platform.Fixed{"USDT": fixed.NewI(1000, 0)})
+
+	trade(t, ex, 1, "100")
+
+	id, err := ex.OrderLimit(ctx, testSymbol, platform.OrderSideBuy, fixed.NewI(105, 0), fixed.NewI(5, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, ex, id, platform.StatusFilled)
+
+	orders, _ := ex.ListOrders(ctx, testSymbol)
+	if len(orders) != 0 {
+		t.Errorf("open orders = %d, want 0", len(orders))
+	}
+
+	// Marketable limit order is executed at the market price as a taker.
+	fills := ex.Fills()
+	if len(fills) != 1 {
+		t.Fatalf("fills = %d, want 1", len(fills))
+	}
+	assertFixed(t, "price", fills[0].Price, "100")
+	assertFixed(t, "fee", fills[0].Fee, "0.01")
+
+	wallet, _ := ex.Wallet(ctx)
+	assertFixed(t, "USDT", wallet["USDT"], "500")
+	assertFixed(t, "BTC", wallet["BTC"], "4.99")
+}
+
+func TestExchangeOCOLimitLeg(t *testing.T) {
+	ctx := context.Background()
+	ex := newTestExchange(t, map[platform.Symbol]platform.Fixed{"BTC": fixed.NewI(1, 0)})
+
+	trade(t, ex, 1, "100")
+
+	stopID, err := ex.OrderOCO(ctx, testSymbol, platform.OrderSideSell, platform.OptionsOCO{
+		Price:    fixed.NewI(110, 0),
+		Stop:     fixed.NewI(95, 0),
+		Limit:    fixed.NewI(96, 0),
+		Quantity: fixed.NewI(1, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders, _ := ex.ListOrders(ctx, testSymbol)
+	if len(orders) != 2 {
+		t.Fatalf("open orders = %d, want 2", len(orders))
+	}
+	limitID := orders[1].OrderID
+
+	trade(t, ex, 2, "111")
+
+	assertStatus(t, ex, limitID, platform.StatusFilled)
+	assertStatus(t, ex, stopID, platform.StatusCanceled)
+
+	wallet, _ := ex.Wallet(ctx)
+	assertFixed(t, "BTC", wallet["BTC"], "0")
+	assertFixed(t, "USDT", wallet["USDT"], "109.89")
+}
+
+func TestExchangeOCOStopLeg(t *testing.T) {
+	ctx := context.Background()
+	ex := newTestExchange(t, map[platform.Symbol]platform.Fixed{"BTC": fixed.NewI(1, 0)})
+
+	trade(t, ex, 1, "100")
+
+	stopID, err := ex.OrderOCO(ctx, testSymbol, platform.OrderSideSell, platform.OptionsOCO{
+		Price:    fixed.NewI(110, 0),
+		Stop:     fixed.NewI(95, 0),
+		Limit:    fixed.NewI(96, 0),
+		Quantity: fixed.NewI(1, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders, _ := ex.ListOrders(ctx, testSymbol)
+	limitID := orders[1].OrderID
+
+	// The stop is triggered below the limit price and rests in the book.
+	trade(t, ex, 2, "94")
+	assertStatus(t, ex, stopID, platform.StatusNew)
+
+	trade(t, ex, 3, "97")
+	assertStatus(t, ex, stopID, platform.StatusFilled)
+	assertStatus(t, ex, limitID, platform.StatusCanceled)
+
+	trade(t, ex, 4, "99")
+
+	wallet, _ := ex.Wallet(ctx)
+	assertFixed(t, "BTC", wallet["BTC"], "0")
+	assertFixed(t, "USDT", wallet["USDT"], "95.904")
+
+	fills := ex.Fills()
+	if len(fills) != 1 {
+		t.Fatalf("fills = %d, want 1", len(fills))
+	}
+	assertFixed(t, "price", fills[0].Price, "96")
+	if fills[0].Time != 3 {
+		t.Errorf("fill time = %d, want 3", fills[0].Time)
+	}
+}
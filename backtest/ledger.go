@@ -0,0 +1,218 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/WinPooh32/series"
+)
+
+type RoundTrip struct {
+	Symbol     platform.Symbol
+	EntryTime  int64
+	ExitTime   int64
+	EntryPrice platform.Fixed
+	ExitPrice  platform.Fixed
+	Quantity   platform.Fixed
+	Holding    time.Duration
+	GrossPnL   platform.Fixed
+	Fees       platform.Fixed
+	NetPnL     platform.Fixed
+}
+
+type lot struct {
+	time     int64
+	price    platform.Fixed
+	quantity platform.Fixed
+	fee      platform.Fixed
+}
+
+// Ledger records fills and pairs sells with preceding buys
+// of the same symbol into round trips in FIFO order.
+type Ledger struct {
+	Fills      []Fill
+	RoundTrips []RoundTrip
+
+	lots map[platform.Symbol][]lot
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		lots: map[platform.Symbol][]lot{},
+	}
+}
+
+func (l *Ledger) Record(f Fill) {
+	l.Fills = append(l.Fills, f)
+
+	switch f.Side {
+	case platform.OrderSideBuy:
+		// The fee is charged in base asset, so less is received.
+		l.lots[f.Symbol] = append(l.lots[f.Symbol], lot{
+			time:     f.Time,
+			price:    f.Price,
+			quantity: f.Quantity.Sub(f.Fee),
+			fee:      f.Fee.Mul(f.Price),
+		})
+
+	case platform.OrderSideSell:
+		open := l.lots[f.Symbol]
+		left := f.Quantity
+
+		for left.Sign() > 0 && len(open) > 0 {
+			lt := &open[0]
+
+			portion := lt.quantity
+			if left.LessThan(portion) {
+				portion = left
+			}
+
+			entryFee := lt.fee.Mul(portion).Div(lt.quantity)
+			exitFee := f.Fee.Mul(portion).Div(f.Quantity)
+			gross := f.Price.Sub(lt.price).Mul(portion)
+			fees := entryFee.Add(exitFee)
+
+			l.RoundTrips = append(l.RoundTrips, RoundTrip{
+				Symbol:     f.Symbol,
+				EntryTime:  lt.time,
+				ExitTime:   f.Time,
+				EntryPrice: lt.price,
+				ExitPrice:  f.Price,
+				Quantity:   portion,
+				Holding:    msToDuration(f.Time - lt.time),
+				GrossPnL:   gross,
+				Fees:       fees,
+				NetPnL:     gross.Sub(fees),
+			})
+
+			lt.quantity = lt.quantity.Sub(portion)
+			lt.fee = lt.fee.Sub(entryFee)
+			left = left.Sub(portion)
+
+			if lt.quantity.Sign() <= 0 {
+				open = open[1:]
+			}
+		}
+
+		l.lots[f.Symbol] = open
+	}
+}
+
+// Fees returns total fees paid converted to the quote asset.
+func (l *Ledger) Fees() platform.Fixed {
+	var fees = fixed.ZERO
+
+	for _, f := range l.Fills {
+		switch f.Side {
+		case platform.OrderSideBuy:
+			fees = fees.Add(f.Fee.Mul(f.Price))
+		case platform.OrderSideSell:
+			fees = fees.Add(f.Fee)
+		}
+	}
+
+	return fees
+}
+
+// Prices returns prices of the fills of the given side.
+func (l *Ledger) Prices(side platform.OrderSide) series.Data {
+	var (
+		index = make([]int64, 0, len(l.Fills))
+		data  = make([]float32, 0, len(l.Fills))
+	)
+
+	for _, f := range l.Fills {
+		if f.Side == side {
+			index = append(index, f.Time)
+			data = append(data, float32(f.Price.Float()))
+		}
+	}
+
+	return series.MakeData(1, index, data)
+}
+
+func (l *Ledger) WriteFillsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"time", "symbol", "order_id", "side", "reason", "price", "quantity", "fee", "fee_asset"})
+	if err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	for _, f := range l.Fills {
+		err = cw.Write([]string{
+			strconv.FormatInt(f.Time, 10),
+			string(f.Symbol),
+			f.OrderID,
+			string(f.Side),
+			f.Reason(),
+			f.Price.String(),
+			f.Quantity.String(),
+			f.Fee.String(),
+			string(f.FeeAsset),
+		})
+		if err != nil {
+			return fmt.Errorf("write fill order=%s: %w", f.OrderID, err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (l *Ledger) WriteRoundTripsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"symbol", "entry_time", "exit_time", "holding", "entry_price", "exit_price", "quantity", "gross_pnl", "fees", "net_pnl"})
+	if err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	for _, t := range l.RoundTrips {
+		err = cw.Write([]string{
+			string(t.Symbol),
+			strconv.FormatInt(t.EntryTime, 10),
+			strconv.FormatInt(t.ExitTime, 10),
+			t.Holding.String(),
+			t.EntryPrice.String(),
+			t.ExitPrice.String(),
+			t.Quantity.String(),
+			t.GrossPnL.String(),
+			t.Fees.String(),
+			t.NetPnL.String(),
+		})
+		if err != nil {
+			return fmt.Errorf("write round trip exit=%d: %w", t.ExitTime, err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Reason describes why the fill happened.
+func (f Fill) Reason() string {
+	switch f.Type {
+	case platform.OrderTypeMarket:
+		return "market"
+	case platform.OrderTypeLimit:
+		return "limit"
+	case platform.OrderTypeLimitMaker:
+		if f.Side == platform.OrderSideSell {
+			return "take profit"
+		}
+		return "limit"
+	case platform.OrderTypeStopLossLimit:
+		if f.Side == platform.OrderSideSell {
+			return "stop loss"
+		}
+		return "stop"
+	default:
+		return string(f.Type)
+	}
+}
@@ -0,0 +1,55 @@
+package backtest
+
+import (
+	"github.com/WinPooh32/retrade/platform"
+)
+
+type source struct {
+	symbol platform.Symbol
+	events <-chan platform.EventContainer
+	head   platform.EventContainer
+	ok     bool
+}
+
+// merger merges event streams of several symbols in time order.
+// Events with equal timestamps keep the order of the sources.
+type merger struct {
+	sources []source
+}
+
+func newMerger(sources []source) *merger {
+	for i := range sources {
+		s := &sources[i]
+		s.head, s.ok = <-s.events
+	}
+	return &merger{
+		sources: sources,
+	}
+}
+
+func (m *merger) next() (symbol platform.Symbol, event platform.EventContainer, ok bool) {
+	var best *source
+
+	for i := range m.sources {
+		s := &m.sources[i]
+		if !s.ok {
+			continue
+		}
+		if s.head.Type == platform.EventErr {
+			best = s
+			break
+		}
+		if best == nil || s.head.Time() < best.head.Time() {
+			best = s
+		}
+	}
+
+	if best == nil {
+		return "", event, false
+	}
+
+	symbol, event = best.symbol, best.head
+	best.head, best.ok = <-best.events
+
+	return symbol, event, true
+}
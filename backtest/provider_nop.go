@@ -18,6 +18,10 @@ func (*NopProvider) OrderMarket(ctx context.Context, symbol platform.Symbol, sid
 	return
 }
 
+func (*NopProvider) OrderLimit(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, price, quantity platform.Fixed) (orderID string, err error) {
+	return
+}
+
 func (*NopProvider) OrderOCO(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, opt platform.OptionsOCO) (orderID string, err error) {
 	return
 }
@@ -28,7 +32,9 @@ func (*NopProvider) Cancel(ctx context.Context, symbol platform.Symbol, orderID
 
 func (*NopProvider) CancelAll(ctx context.Context, symbol platform.Symbol) (err error) { return }
 
-func (*NopProvider) QueryOrder(ctx context.Context) (err error) { return }
+func (*NopProvider) QueryOrder(ctx context.Context, symbol platform.Symbol, orderID string) (order platform.Order, err error) {
+	return
+}
 
 func (*NopProvider) ListOrders(ctx context.Context, symbol platform.Symbol) (orders []platform.Order, err error) {
 	return
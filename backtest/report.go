@@ -0,0 +1,274 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WinPooh32/series"
+)
+
+const year = int64(365 * 24 * time.Hour / time.Millisecond)
+
+type Report struct {
+	Start               int64         `json:"start"`
+	End                 int64         `json:"end"`
+	InitialEquity       float64       `json:"initial_equity"`
+	FinalEquity         float64       `json:"final_equity"`
+	TotalReturn         float64       `json:"total_return"`
+	AnnualReturn        float64       `json:"annual_return"`
+	MaxDrawdown         float64       `json:"max_drawdown"`
+	MaxDrawdownDuration time.Duration `json:"max_drawdown_duration"`
+	Sharpe              float64       `json:"sharpe"`
+	Sortino             float64       `json:"sortino"`
+	WinRate             float64       `json:"win_rate"`
+	ProfitFactor        float64       `json:"profit_factor"`
+	AvgTradePnL         float64       `json:"avg_trade_pnl"`
+	Exposure            float64       `json:"exposure"`
+	Fees                float64       `json:"fees"`
+	RoundTrips          int           `json:"round_trips"`
+}
+
+// NewReport computes performance metrics of the equity curve sampled
+// between start and end times in milliseconds and of the ledger trades.
+func NewReport(ledger *Ledger, equity series.Data, start, end int64) Report {
+	var r = Report{
+		Start: start,
+		End:   end,
+	}
+
+	r.Fees = ledger.Fees().Float()
+
+	trips := ledger.RoundTrips
+	r.RoundTrips = len(trips)
+	r.WinRate, r.ProfitFactor, r.AvgTradePnL = tradeStats(trips)
+	r.Exposure = exposure(ledger, start, end)
+
+	values := equity.Data()
+	if len(values) == 0 {
+		return r
+	}
+
+	r.InitialEquity = float64(values[0])
+	r.FinalEquity = float64(values[len(values)-1])
+
+	if r.InitialEquity != 0 {
+		r.TotalReturn = r.FinalEquity/r.InitialEquity - 1
+	}
+
+	years := float64(end-start) / float64(year)
+	if years > 0 && r.TotalReturn > -1 {
+		r.AnnualReturn = math.Pow(1+r.TotalReturn, 1/years) - 1
+	}
+
+	r.MaxDrawdown, r.MaxDrawdownDuration = drawdown(equity.Index(), values, end)
+
+	if years > 0 && len(values) > 1 {
+		periodsPerYear := float64(len(values)-1) / years
+		r.Sharpe, r.Sortino = riskRatios(values, periodsPerYear)
+	}
+
+	// Annualising of short periods may overflow, which is not representable in JSON.
+	for _, v := range []*float64{&r.AnnualReturn, &r.Sharpe, &r.Sortino} {
+		if math.IsInf(*v, 0) || math.IsNaN(*v) {
+			*v = 0
+		}
+	}
+
+	return r
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+
+	line := func(name string, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-24s "+format+"\n", append([]interface{}{name + ":"}, args...)...)
+	}
+
+	line("Period", "%s - %s", msToTime(r.Start).Format(time.RFC3339), msToTime(r.End).Format(time.RFC3339))
+	line("Initial equity", "%.2f", r.InitialEquity)
+	line("Final equity", "%.2f", r.FinalEquity)
+	line("Total return", "%.2f%%", r.TotalReturn*100)
+	line("Annual return", "%.2f%%", r.AnnualReturn*100)
+	line("Max drawdown", "%.2f%%", r.MaxDrawdown*100)
+	line("Max drawdown duration", "%s", r.MaxDrawdownDuration)
+	line("Sharpe ratio", "%.3f", r.Sharpe)
+	line("Sortino ratio", "%.3f", r.Sortino)
+	line("Win rate", "%.2f%%", r.WinRate*100)
+	line("Profit factor", "%.3f", r.ProfitFactor)
+	line("Average trade P&L", "%.4f", r.AvgTradePnL)
+	line("Exposure", "%.2f%%", r.Exposure*100)
+	line("Fees paid", "%.4f", r.Fees)
+	line("Round trips", "%d", r.RoundTrips)
+
+	return b.String()
+}
+
+func tradeStats(trips []RoundTrip) (winRate, profitFactor, avgPnL float64) {
+	if len(trips) == 0 {
+		return
+	}
+
+	var wins int
+	var profit, loss, total float64
+
+	for _, t := range trips {
+		pnl := t.NetPnL.Float()
+		total += pnl
+		if pnl > 0 {
+			wins++
+			profit += pnl
+		} else {
+			loss -= pnl
+		}
+	}
+
+	winRate = float64(wins) / float64(len(trips))
+	avgPnL = total / float64(len(trips))
+
+	// Profit factor is left zero without losing trades.
+	if loss > 0 {
+		profitFactor = profit / loss
+	}
+
+	return
+}
+
+// holding is a period of a held position.
+type holding struct{ from, to int64 }
+
+func exposure(ledger *Ledger, start, end int64) float64 {
+	if end <= start {
+		return 0
+	}
+
+	periods := make([]holding, 0, len(ledger.RoundTrips))
+	for _, t := range ledger.RoundTrips {
+		periods = append(periods, holding{t.EntryTime, t.ExitTime})
+	}
+	// Positions still open are held up to the end.
+	for _, lots := range ledger.lots {
+		for _, lt := range lots {
+			periods = append(periods, holding{lt.time, end})
+		}
+	}
+
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].from < periods[j].from
+	})
+
+	// Overlapping holdings are counted once.
+	var held, from, to int64 = 0, 0, -1
+
+	for _, p := range periods {
+		if p.from > to {
+			if to > from {
+				held += to - from
+			}
+			from, to = p.from, p.to
+			continue
+		}
+		if p.to > to {
+			to = p.to
+		}
+	}
+	if to > from {
+		held += to - from
+	}
+
+	return float64(held) / float64(end-start)
+}
+
+func drawdown(index []int64, values []float32, end int64) (maxDD float64, maxDuration time.Duration) {
+	var (
+		peak     = float64(values[0])
+		peakTime = index[0]
+		dipped   bool
+	)
+
+	for i, v := range values {
+		value := float64(v)
+
+		if value >= peak {
+			if d := msToDuration(index[i] - peakTime); dipped && d > maxDuration {
+				maxDuration = d
+			}
+			peak = value
+			peakTime = index[i]
+			dipped = false
+			continue
+		}
+
+		dipped = true
+
+		if peak > 0 {
+			if dd := (peak - value) / peak; dd > maxDD {
+				maxDD = dd
+			}
+		}
+	}
+
+	// Drawdown which is not recovered until the end.
+	if dipped {
+		if d := msToDuration(end - peakTime); d > maxDuration {
+			maxDuration = d
+		}
+	}
+
+	return maxDD, maxDuration
+}
+
+func riskRatios(values []float32, periodsPerYear float64) (sharpe, sortino float64) {
+	var (
+		n       = len(values) - 1
+		returns = make([]float64, 0, n)
+		mean    float64
+	)
+
+	for i := 1; i < len(values); i++ {
+		prev := float64(values[i-1])
+		if prev == 0 {
+			continue
+		}
+		ret := float64(values[i])/prev - 1
+		returns = append(returns, ret)
+		mean += ret
+	}
+
+	if len(returns) < 2 {
+		return
+	}
+
+	mean /= float64(len(returns))
+
+	var variance, downside float64
+	for _, ret := range returns {
+		variance += (ret - mean) * (ret - mean)
+		if ret < 0 {
+			downside += ret * ret
+		}
+	}
+	variance /= float64(len(returns) - 1)
+	downside /= float64(len(returns))
+
+	scale := math.Sqrt(periodsPerYear)
+
+	if std := math.Sqrt(variance); std > 0 {
+		sharpe = mean / std * scale
+	}
+	if dev := math.Sqrt(downside); dev > 0 {
+		sortino = mean / dev * scale
+	}
+
+	return
+}
+
+func msToTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
+
+func msToDuration(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,170 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/WinPooh32/series"
+)
+
+// third of a year, equity sampled by thirds over a year has 3 returns per year.
+const third = year / 3
+
+func fill(side platform.OrderSide, t int64, price, fee string) Fill {
+	return Fill{
+		Symbol:   testSymbol,
+		Side:     side,
+		Time:     t,
+		Price:    fixed.NewS(price),
+		Quantity: fixed.NewI(1, 0),
+		Fee:      fixed.NewS(fee),
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		name   string
+		fills  []Fill
+		equity []float32
+		start  int64
+		end    int64
+		want   Report
+	}{
+		{
+			// Trips of +10, -11 and +5 less 0.5 of fee, the last buy is still open.
+			// Returns are +10%, -10% and +10%:
+			// mean = 1/30, sample std = sqrt(0.04/3), downside deviation = sqrt(0.01/3),
+			// Sharpe = mean/std*sqrt(3) = 0.5, Sortino = mean/dev*sqrt(3) = 1.
+			name: "mixed",
+			fills: []Fill{
+				fill(platform.OrderSideBuy, 0, "100", "0"),
+				fill(platform.OrderSideSell, third, "110", "0"),
+				fill(platform.OrderSideBuy, third, "110", "0"),
+				fill(platform.OrderSideSell, 2*third, "99", "0"),
+				fill(platform.OrderSideBuy, 2*third, "100", "0"),
+				fill(platform.OrderSideSell, 2*third+third/4, "105", "0.5"),
+				fill(platform.OrderSideBuy, 2*third+third/2, "104", "0"),
+			},
+			equity: []float32{100, 110, 99, 108.9},
+			start:  0,
+			end:    year,
+			want: Report{
+				InitialEquity: 100,
+				FinalEquity:   108.9,
+				TotalReturn:   0.089,
+				AnnualReturn:  0.089,
+				// 110 to 99 is not recovered until the end.
+				MaxDrawdown:         0.1,
+				MaxDrawdownDuration: msToDuration(2 * third),
+				Sharpe:              0.5,
+				Sortino:             1,
+				WinRate:             2.0 / 3,
+				ProfitFactor:        14.5 / 11,
+				AvgTradePnL:         3.5 / 3,
+				// Held all the time but from 2.25 to 2.5 thirds.
+				Exposure:   2.75 / 3,
+				Fees:       0.5,
+				RoundTrips: 3,
+			},
+		},
+		{
+			// Returns are +25%, -20% and +25%:
+			// mean = 0.1, sample std = sqrt(0.0675), downside deviation = sqrt(0.04/3),
+			// Sharpe = 0.1/sqrt(0.0675)*sqrt(3) = 2/3, Sortino = 0.1/sqrt(0.04/3)*sqrt(3) = 1.5.
+			name:   "recovered",
+			equity: []float32{100, 125, 100, 125},
+			start:  0,
+			end:    year,
+			want: Report{
+				InitialEquity:       100,
+				FinalEquity:         125,
+				TotalReturn:         0.25,
+				AnnualReturn:        0.25,
+				MaxDrawdown:         0.2,
+				MaxDrawdownDuration: msToDuration(2 * third),
+				Sharpe:              2.0 / 3,
+				Sortino:             1.5,
+			},
+		},
+		{
+			// Profit factor is zero without losses.
+			name: "wins only",
+			fills: []Fill{
+				fill(platform.OrderSideBuy, 0, "100", "0"),
+				fill(platform.OrderSideSell, third, "110", "0"),
+				fill(platform.OrderSideBuy, 2*third, "100", "0"),
+			},
+			equity: []float32{100, 110, 110, 110},
+			start:  0,
+			end:    year,
+			want: Report{
+				InitialEquity: 100,
+				FinalEquity:   110,
+				TotalReturn:   0.1,
+				AnnualReturn:  0.1,
+				// Returns are +10%, 0 and 0: mean = 1/30, sample std = sqrt(0.01/3),
+				// Sharpe = 1, Sortino is zero without downside.
+				Sharpe:      1,
+				WinRate:     1,
+				AvgTradePnL: 10,
+				// The buy at 2/3 of the year is open until the end.
+				Exposure:   2.0 / 3,
+				RoundTrips: 1,
+			},
+		},
+		{
+			name:  "empty",
+			start: 0,
+			end:   year,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewLedger()
+			for _, f := range tt.fills {
+				ledger.Record(f)
+			}
+
+			index := make([]int64, len(tt.equity))
+			for i := range index {
+				index[i] = int64(i) * third
+			}
+
+			r := NewReport(ledger, series.MakeData(third, index, tt.equity), tt.start, tt.end)
+
+			for _, m := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"initial equity", r.InitialEquity, tt.want.InitialEquity},
+				{"final equity", r.FinalEquity, tt.want.FinalEquity},
+				{"total return", r.TotalReturn, tt.want.TotalReturn},
+				{"annual return", r.AnnualReturn, tt.want.AnnualReturn},
+				{"max drawdown", r.MaxDrawdown, tt.want.MaxDrawdown},
+				{"sharpe", r.Sharpe, tt.want.Sharpe},
+				{"sortino", r.Sortino, tt.want.Sortino},
+				{"win rate", r.WinRate, tt.want.WinRate},
+				{"profit factor", r.ProfitFactor, tt.want.ProfitFactor},
+				{"average trade pnl", r.AvgTradePnL, tt.want.AvgTradePnL},
+				{"exposure", r.Exposure, tt.want.Exposure},
+				{"fees", r.Fees, tt.want.Fees},
+			} {
+				// Equity is sampled in float32.
+				if math.Abs(m.got-m.want) > 1e-6*math.Max(1, math.Abs(m.want)) {
+					t.Errorf("%s = %v, want %v", m.name, m.got, m.want)
+				}
+			}
+
+			if d := r.MaxDrawdownDuration - tt.want.MaxDrawdownDuration; d < -time.Millisecond || d > time.Millisecond {
+				t.Errorf("max drawdown duration = %v, want %v", r.MaxDrawdownDuration, tt.want.MaxDrawdownDuration)
+			}
+			if r.RoundTrips != tt.want.RoundTrips {
+				t.Errorf("round trips = %d, want %d", r.RoundTrips, tt.want.RoundTrips)
+			}
+		})
+	}
+}
@@ -1,19 +1,15 @@
 package backtest
 
 import (
-	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/book"
 	"github.com/WinPooh32/retrade/candle"
 	"github.com/WinPooh32/retrade/ring/ringmapf64"
 )
 
 type runstate struct {
-	side         int
-	next         bool
-	finishedTick int64
-	tick         int64
-
-	account float32
-	pool    float32
+	next bool
+	tick int64
+	time int64
 
 	price *candle.Candle
 
@@ -26,60 +22,56 @@ type runstate struct {
 	bestAsk *candle.Candle
 	bestBid *candle.Candle
 
+	book          *book.Book
+	bookImbalance *candle.Candle
+	bidDepth      *candle.Candle
+	askDepth      *candle.Candle
+
 	volumeClusters       ringmapf64.Ring
 	volumeClustersMoment map[float64]float64
 
 	clusters []map[float64]float64
 }
 
-func (state *runstate) doBuy(strategy Strategy, snap HistorySnaphsot, opt Options) (buyTime int64, price float32, ok bool) {
-	var closePrice fixed.Fixed
-
-	buyTime, _, _, _, closePrice, _ = state.price.Last()
-	price = float32(closePrice.Float())
-
-	if strategy.BuySignal(snap) {
-		state.account = state.buy(state.account, price, opt.FeeBuy)
-		state.side = sell
-
-		ok = true
-		return
+func makeRunstate(opt Options) runstate {
+	return runstate{
+		price:          candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		buyBestCount:   candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		sellBestCount:  candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		buyBestVolume:  candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		sellBestVolume: candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		bestAsk:        candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		bestBid:        candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+
+		book:          book.New(),
+		bookImbalance: candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		bidDepth:      candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+		askDepth:      candle.NewCandle(opt.FramePeriod, int(opt.HistoryWindowSize)),
+
+		volumeClusters:       ringmapf64.MakeRing(int(opt.HistoryWindowSize)),
+		volumeClustersMoment: map[float64]float64{},
+
+		clusters: make([]map[float64]float64, 0, int(opt.HistoryWindowSize)),
 	}
-
-	ok = false
-	return
 }
 
-func (state *runstate) doSell(strategy Strategy, snap HistorySnaphsot, opt Options) (buyTime int64, price float32, account float32, ok bool) {
-	var closePrice fixed.Fixed
-
-	buyTime, _, _, _, closePrice, _ = state.price.Last()
-	price = float32(closePrice.Float())
-
-	if strategy.SellSignal(snap) {
-		state.account = state.sell(state.account, price, opt.FeeSell)
-		state.side = buy
-
-		if opt.Limit != 0 && state.account > opt.Limit {
-			state.pool += state.account - opt.Limit
-			state.account = opt.Limit
-		}
-
-		account = state.account
-		ok = true
-		return
+func (state *runstate) snapshot() HistorySnaphsot {
+	state.volumeClusters.ForcePushBack(state.volumeClustersMoment)
+	n := state.volumeClusters.CopyTo(state.clusters[:state.volumeClusters.Len()])
+
+	state.volumeClustersMoment = map[float64]float64{}
+
+	return HistorySnaphsot{
+		Price:          state.price.HistoryFloat32(),
+		BuyBestCount:   state.buyBestCount.HistoryFloat32(),
+		BuyBestVolume:  state.buyBestVolume.HistoryFloat32(),
+		SellBestCount:  state.sellBestCount.HistoryFloat32(),
+		SellBestVolume: state.sellBestVolume.HistoryFloat32(),
+		BestAsk:        state.bestAsk.HistoryFloat32(),
+		BestBid:        state.bestBid.HistoryFloat32(),
+		BookImbalance:  state.bookImbalance.HistoryFloat32(),
+		BidDepth:       state.bidDepth.HistoryFloat32(),
+		AskDepth:       state.askDepth.HistoryFloat32(),
+		VolumeClusters: state.clusters[:n],
 	}
-
-	ok = false
-	return
-}
-
-func (*runstate) buy(account float32, price float32, fee float32) float32 {
-	fee = account * fee
-	return (account - fee) / price
-}
-
-func (*runstate) sell(account float32, price float32, fee float32) float32 {
-	fee = account * fee
-	return (account - fee) * price
 }
@@ -0,0 +1,137 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+type StrategyContext struct {
+	Symbol   platform.Symbol
+	Market   Market
+	Time     int64
+	Spot     platform.Spot
+	Account  platform.Account
+	Snapshot HistorySnaphsot
+
+	// Snapshots and Markets hold all traded symbols including Symbol.
+	Snapshots map[platform.Symbol]HistorySnaphsot
+	Markets   map[platform.Symbol]Market
+}
+
+// OrderStrategy places orders by itself on every filled frame.
+type OrderStrategy interface {
+	Name() string
+	Next(ctx context.Context, sc StrategyContext) error
+}
+
+// SignalStrategy adapts a boolean Strategy to OrderStrategy.
+// It buys with the whole account at the market and sells everything
+// bought on the next sell signal. The account starts with Options.Account,
+// or the whole free balance if it is zero, and is limited by the free balance.
+type SignalStrategy struct {
+	strategy Strategy
+	opt      Options
+
+	long    bool
+	account platform.Fixed
+	holding platform.Fixed
+	pool    platform.Fixed
+}
+
+var _ OrderStrategy = &SignalStrategy{}
+
+func NewSignalStrategy(strategy Strategy, opt Options) *SignalStrategy {
+	return &SignalStrategy{
+		strategy: strategy,
+		opt:      opt,
+		account:  fixed.NewF(float64(opt.Account)),
+		holding:  fixed.ZERO,
+		pool:     fixed.ZERO,
+	}
+}
+
+func (s *SignalStrategy) Name() string {
+	return s.strategy.Name()
+}
+
+func (s *SignalStrategy) Next(ctx context.Context, sc StrategyContext) error {
+	if s.long {
+		if !s.strategy.SellSignal(sc.Snapshot) {
+			return nil
+		}
+		return s.sell(ctx, sc)
+	}
+
+	if !s.strategy.BuySignal(sc.Snapshot) {
+		return nil
+	}
+	return s.buy(ctx, sc)
+}
+
+func (s *SignalStrategy) Pool() float32 {
+	return float32(s.pool.Float())
+}
+
+func (s *SignalStrategy) buy(ctx context.Context, sc StrategyContext) error {
+	before, err := sc.Account.Wallet(ctx)
+	if err != nil {
+		return fmt.Errorf("wallet: %w", err)
+	}
+
+	var (
+		free   = before[sc.Market.Quote].Sub(s.pool)
+		amount = s.account
+	)
+	if amount.IsZero() || amount.GreaterThan(free) {
+		amount = free
+	}
+	if amount.Sign() <= 0 {
+		return nil
+	}
+
+	_, err = sc.Spot.OrderMarket(ctx, sc.Symbol, platform.OrderSideBuy, amount)
+	if err != nil {
+		return fmt.Errorf("order market buy: %w", err)
+	}
+
+	after, err := sc.Account.Wallet(ctx)
+	if err != nil {
+		return fmt.Errorf("wallet: %w", err)
+	}
+
+	s.holding = after[sc.Market.Base].Sub(before[sc.Market.Base])
+	s.long = true
+
+	return nil
+}
+
+func (s *SignalStrategy) sell(ctx context.Context, sc StrategyContext) error {
+	before, err := sc.Account.Wallet(ctx)
+	if err != nil {
+		return fmt.Errorf("wallet: %w", err)
+	}
+
+	_, err = sc.Spot.OrderMarket(ctx, sc.Symbol, platform.OrderSideSell, s.holding)
+	if err != nil {
+		return fmt.Errorf("order market sell: %w", err)
+	}
+
+	after, err := sc.Account.Wallet(ctx)
+	if err != nil {
+		return fmt.Errorf("wallet: %w", err)
+	}
+
+	s.account = after[sc.Market.Quote].Sub(before[sc.Market.Quote])
+	s.holding = fixed.ZERO
+	s.long = false
+
+	if limit := fixed.NewF(float64(s.opt.Limit)); !limit.IsZero() && s.account.GreaterThan(limit) {
+		s.pool = s.pool.Add(s.account.Sub(limit))
+		s.account = limit
+	}
+
+	return nil
+}
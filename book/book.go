@@ -0,0 +1,180 @@
+package book
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+var (
+	ErrNotSynced = fmt.Errorf("order book is not synced")
+	ErrGap       = fmt.Errorf("order book update gap")
+)
+
+// Book is an L2 order book built of a snapshot and following updates.
+//
+// Updates are sequenced by their ids: stale updates are skipped and
+// an update starting after the last applied id breaks the book until
+// the next snapshot.
+type Book struct {
+	bids map[int64]fixed.Fixed
+	asks map[int64]fixed.Fixed
+
+	time         int64
+	lastUpdateID int64
+	synced       bool
+}
+
+func New() *Book {
+	return &Book{
+		bids: map[int64]fixed.Fixed{},
+		asks: map[int64]fixed.Fixed{},
+	}
+}
+
+func (b *Book) Apply(d platform.Depth) error {
+	if d.Snapshot {
+		b.bids = make(map[int64]fixed.Fixed, len(d.Bids))
+		b.asks = make(map[int64]fixed.Fixed, len(d.Asks))
+		b.synced = true
+	} else {
+		if !b.synced {
+			return ErrNotSynced
+		}
+		if d.FinalUpdateID <= b.lastUpdateID {
+			return nil
+		}
+		if d.FirstUpdateID > b.lastUpdateID+1 {
+			b.synced = false
+			return fmt.Errorf("%w: last id=%d, next first id=%d", ErrGap, b.lastUpdateID, d.FirstUpdateID)
+		}
+	}
+
+	update(b.bids, d.Bids)
+	update(b.asks, d.Asks)
+
+	b.time = d.Time
+	b.lastUpdateID = d.FinalUpdateID
+
+	return nil
+}
+
+func update(side map[int64]fixed.Fixed, levels []platform.PriceLevel) {
+	for _, l := range levels {
+		if l.Quantity.IsZero() {
+			delete(side, l.Price.Raw())
+		} else {
+			side[l.Price.Raw()] = l.Quantity
+		}
+	}
+}
+
+func (b *Book) Synced() bool {
+	return b.synced
+}
+
+func (b *Book) Time() int64 {
+	return b.time
+}
+
+func (b *Book) LastUpdateID() int64 {
+	return b.lastUpdateID
+}
+
+// Bids returns bid levels from the best one.
+func (b *Book) Bids() []platform.PriceLevel {
+	levels := makeLevels(b.bids)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Price.GreaterThan(levels[j].Price) })
+	return levels
+}
+
+// Asks returns ask levels from the best one.
+func (b *Book) Asks() []platform.PriceLevel {
+	levels := makeLevels(b.asks)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Price.LessThan(levels[j].Price) })
+	return levels
+}
+
+func makeLevels(side map[int64]fixed.Fixed) []platform.PriceLevel {
+	levels := make([]platform.PriceLevel, 0, len(side))
+	for price, qty := range side {
+		levels = append(levels, platform.PriceLevel{Price: fixed.NewRaw(price), Quantity: qty})
+	}
+	return levels
+}
+
+func (b *Book) BestBid() (best platform.PriceLevel, ok bool) {
+	for price, qty := range b.bids {
+		if !ok || price > best.Price.Raw() {
+			best, ok = platform.PriceLevel{Price: fixed.NewRaw(price), Quantity: qty}, true
+		}
+	}
+	return best, ok
+}
+
+func (b *Book) BestAsk() (best platform.PriceLevel, ok bool) {
+	for price, qty := range b.asks {
+		if !ok || price < best.Price.Raw() {
+			best, ok = platform.PriceLevel{Price: fixed.NewRaw(price), Quantity: qty}, true
+		}
+	}
+	return best, ok
+}
+
+// Mid returns the middle price between the best bid and ask.
+func (b *Book) Mid() (mid fixed.Fixed, ok bool) {
+	bid, ok := b.BestBid()
+	if !ok {
+		return mid, false
+	}
+	ask, ok := b.BestAsk()
+	if !ok {
+		return mid, false
+	}
+	return bid.Price.Add(ask.Price).Div(fixed.NewI(2, 0)), true
+}
+
+// Depth returns quantities of the levels within the distance
+// from the mid price, distance is a fraction of the mid price.
+func (b *Book) Depth(distance float64) (bid, ask fixed.Fixed) {
+	bid, ask = fixed.ZERO, fixed.ZERO
+
+	mid, ok := b.Mid()
+	if !ok {
+		return bid, ask
+	}
+
+	var (
+		delta = mid.Mul(fixed.NewF(distance))
+		low   = mid.Sub(delta).Raw()
+		high  = mid.Add(delta).Raw()
+	)
+
+	for price, qty := range b.bids {
+		if price >= low {
+			bid = bid.Add(qty)
+		}
+	}
+	for price, qty := range b.asks {
+		if price <= high {
+			ask = ask.Add(qty)
+		}
+	}
+
+	return bid, ask
+}
+
+// Imbalance returns (bid - ask) / (bid + ask) of the depth within
+// the distance, it is positive if bids prevail.
+func (b *Book) Imbalance(distance float64) float64 {
+	bid, ask := b.Depth(distance)
+
+	sum := bid.Add(ask)
+	if sum.IsZero() {
+		return 0
+	}
+
+	return bid.Sub(ask).Float() / sum.Float()
+}
@@ -0,0 +1,176 @@
+package book
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+func level(price, qty string) platform.PriceLevel {
+	return platform.PriceLevel{Price: fixed.NewS(price), Quantity: fixed.NewS(qty)}
+}
+
+func snapshot(last int64) platform.Depth {
+	return platform.Depth{
+		Time:          1000,
+		FinalUpdateID: last,
+		Bids:          []platform.PriceLevel{level("99", "1"), level("98", "2"), level("97", "3")},
+		Asks:          []platform.PriceLevel{level("101", "1"), level("102", "2")},
+		Snapshot:      true,
+	}
+}
+
+func diff(first, final int64, bids, asks []platform.PriceLevel) platform.Depth {
+	return platform.Depth{
+		Time:          1000 + final,
+		FirstUpdateID: first,
+		FinalUpdateID: final,
+		Bids:          bids,
+		Asks:          asks,
+	}
+}
+
+func assertLevels(t *testing.T, side string, got []platform.PriceLevel, want ...platform.PriceLevel) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", side, got, want)
+	}
+	for i := range want {
+		if !got[i].Price.Equal(want[i].Price) || !got[i].Quantity.Equal(want[i].Quantity) {
+			t.Fatalf("%s = %v, want %v", side, got, want)
+		}
+	}
+}
+
+func TestApplyFirstDiff(t *testing.T) {
+	tests := []struct {
+		name         string
+		first, final int64
+		applied      bool
+	}{
+		{"stale", 90, 100, false},
+		{"straddles", 95, 105, true},
+		{"follows", 101, 105, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			if err := b.Apply(snapshot(100)); err != nil {
+				t.Fatal(err)
+			}
+
+			err := b.Apply(diff(tt.first, tt.final, []platform.PriceLevel{level("99", "5")}, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := int64(100)
+			if tt.applied {
+				want = tt.final
+			}
+			if b.LastUpdateID() != want || !b.Synced() {
+				t.Errorf("last update id = %d, synced = %v, want %d", b.LastUpdateID(), b.Synced(), want)
+			}
+
+			bid, _ := b.BestBid()
+			if applied := bid.Quantity.Equal(fixed.NewI(5, 0)); applied != tt.applied {
+				t.Errorf("best bid = %v, applied = %v", bid, tt.applied)
+			}
+		})
+	}
+}
+
+func TestApplyGap(t *testing.T) {
+	b := New()
+
+	if err := b.Apply(diff(1, 2, nil, nil)); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("err = %v, want %v", err, ErrNotSynced)
+	}
+
+	if err := b.Apply(snapshot(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Apply(diff(102, 105, nil, nil)); !errors.Is(err, ErrGap) {
+		t.Fatalf("err = %v, want %v", err, ErrGap)
+	}
+	if b.Synced() {
+		t.Fatal("book is synced after a gap")
+	}
+
+	// Updates are rejected until the next snapshot.
+	if err := b.Apply(diff(106, 107, nil, nil)); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("err = %v, want %v", err, ErrNotSynced)
+	}
+
+	if err := b.Apply(snapshot(110)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Apply(diff(111, 112, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Synced() || b.LastUpdateID() != 112 {
+		t.Errorf("synced = %v, last update id = %d", b.Synced(), b.LastUpdateID())
+	}
+}
+
+func TestApplyLevels(t *testing.T) {
+	b := New()
+
+	if err := b.Apply(snapshot(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Zero quantity removes the best levels, others are added or replaced.
+	err := b.Apply(diff(101, 101,
+		[]platform.PriceLevel{level("99", "0"), level("97", "4"), level("96", "1")},
+		[]platform.PriceLevel{level("101", "0"), level("103", "1")},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertLevels(t, "bids", b.Bids(), level("98", "2"), level("97", "4"), level("96", "1"))
+	assertLevels(t, "asks", b.Asks(), level("102", "2"), level("103", "1"))
+
+	bid, ok := b.BestBid()
+	if !ok || !bid.Price.Equal(fixed.NewI(98, 0)) {
+		t.Errorf("best bid = %v, %v", bid, ok)
+	}
+	ask, ok := b.BestAsk()
+	if !ok || !ask.Price.Equal(fixed.NewI(102, 0)) {
+		t.Errorf("best ask = %v, %v", ask, ok)
+	}
+	if mid, ok := b.Mid(); !ok || !mid.Equal(fixed.NewI(100, 0)) {
+		t.Errorf("mid = %v, %v", mid, ok)
+	}
+	if b.Time() != 1101 {
+		t.Errorf("time = %d, want 1101", b.Time())
+	}
+
+	// The depth within 2% of the mid price.
+	bidQty, askQty := b.Depth(0.02)
+	if !bidQty.Equal(fixed.NewI(2, 0)) || !askQty.Equal(fixed.NewI(2, 0)) {
+		t.Errorf("depth = %v, %v, want 2, 2", bidQty, askQty)
+	}
+}
+
+func TestBestEmpty(t *testing.T) {
+	b := New()
+
+	if _, ok := b.BestBid(); ok {
+		t.Error("best bid of an empty book")
+	}
+	if _, ok := b.BestAsk(); ok {
+		t.Error("best ask of an empty book")
+	}
+	if _, ok := b.Mid(); ok {
+		t.Error("mid of an empty book")
+	}
+	if imbalance := b.Imbalance(0.01); imbalance != 0 {
+		t.Errorf("imbalance = %v, want 0", imbalance)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WinPooh32/retrade/history"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/WinPooh32/retrade/provider/binance"
+)
+
+type Options struct {
+	Dir      string
+	Name     string
+	Start    int64
+	Extended bool
+	Testnet  bool
+	BaseURL  string
+}
+
+func main() {
+	var (
+		symbols   = flag.String("symbols", "BTCUSDT", "comma separated symbols")
+		intervals = flag.String("intervals", "30m", "comma separated intervals")
+		dir       = flag.String("dir", ".", "directory of the history files")
+		name      = flag.String("name", "%s_%s.csv", "file name format of symbol and interval, compression is chosen by extension")
+		start     = flag.String("start", "", "start date YYYY-MM-DD of new files, the latest klines are fetched if empty")
+		extended  = flag.Bool("extended", false, "write extended columns to new files")
+		testnet   = flag.Bool("testnet", false, "use testnet")
+		baseURL   = flag.String("base-url", "", "override API host, e.g. https://api.binance.com")
+	)
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	opt := Options{
+		Dir:      *dir,
+		Name:     *name,
+		Extended: *extended,
+		Testnet:  *testnet,
+		BaseURL:  *baseURL,
+	}
+
+	if *start != "" {
+		t, err := time.Parse("2006-01-02", *start)
+		if err != nil {
+			fmt.Println("parse start:", err)
+			os.Exit(2)
+		}
+		opt.Start = t.UnixNano() / int64(time.Millisecond)
+	}
+
+	var failed bool
+
+	for _, symbol := range split(*symbols) {
+		for _, interval := range split(*intervals) {
+			n, err := sync(ctx, opt, platform.Symbol(strings.ToUpper(symbol)), interval)
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("interrupted.")
+				os.Exit(1)
+			}
+			if err != nil {
+				fmt.Printf("sync symbol=%s interval=%s: %s\n", symbol, interval, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("synced symbol=%s interval=%s: %d new candles\n", symbol, interval, n)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// sync appends missing closed candles to the history file.
+// The file is rewritten into a temporary one and renamed over,
+// so it stays intact if the sync fails.
+func sync(ctx context.Context, opt Options, symbol platform.Symbol, interval string) (n int, err error) {
+	ticks, letter, err := parseInterval(interval)
+	if err != nil {
+		return 0, err
+	}
+
+	name := filepath.Join(opt.Dir, fmt.Sprintf(opt.Name, symbol, interval))
+
+	extended, err := isExtended(name, opt.Extended)
+	if err != nil {
+		return 0, fmt.Errorf("detect layout: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	cw, err := history.Compress(tmp, history.CompressionFromName(name))
+	if err != nil {
+		return 0, fmt.Errorf("compress: %w", err)
+	}
+
+	exists, err := copyHistory(cw, name)
+	if err != nil {
+		return 0, fmt.Errorf("copy history: %w", err)
+	}
+
+	w, err := history.NewWriterWith(cw, history.WriterOptions{
+		Extended: extended,
+		Append:   exists,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("history new writer: %w", err)
+	}
+
+	provider := binance.NewHistoryWith(opt.Testnet, ticks, letter, binance.HistoryOptions{
+		Start:   opt.Start,
+		Resume:  name,
+		BaseURL: opt.BaseURL,
+	})
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	for e := range provider.Subscribe(ctx, symbol) {
+		switch e.Type {
+		case platform.EventErr:
+			return 0, fmt.Errorf("event: %w", e.Error)
+		case platform.EventCandle:
+			c := e.Event.Candle
+			// Skip the candle in progress.
+			if c.TimeClose >= now {
+				continue
+			}
+			err = w.Write(history.OHLCV{
+				Time:                c.Time,
+				Open:                c.Open,
+				High:                c.High,
+				Low:                 c.Low,
+				Close:               c.Close,
+				Volume:              c.Volume,
+				TimeClose:           c.TimeClose,
+				VolumeQuote:         c.VolumeQuote,
+				CountTrades:         c.CountTrades,
+				VolumeTakerBuyBase:  c.VolumeTakerBuyBase,
+				VolumeTakerBuyQuote: c.VolumeTakerBuyQuote,
+			})
+			if err != nil {
+				return 0, fmt.Errorf("write: %w", err)
+			}
+			n++
+		}
+	}
+
+	if err = cw.Close(); err != nil {
+		return 0, fmt.Errorf("close compressor: %w", err)
+	}
+	// The temporary file is private, keep the mode of the archive.
+	mode := os.FileMode(0o644)
+	if st, serr := os.Stat(name); serr == nil {
+		mode = st.Mode().Perm()
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return 0, fmt.Errorf("chmod: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return 0, fmt.Errorf("sync: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, fmt.Errorf("close: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return 0, fmt.Errorf("rename: %w", err)
+	}
+
+	return n, nil
+}
+
+// copyHistory writes decompressed content of the existing file as is
+// and reports whether it is not empty.
+func copyHistory(w io.Writer, name string) (exists bool, err error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	r, err := history.Decompress(f)
+	if err != nil {
+		return false, fmt.Errorf("decompress: %w", err)
+	}
+	defer r.Close()
+
+	n, err := io.Copy(w, r)
+	return n > 0, err
+}
+
+// isExtended reports whether the existing file starts with a header line.
+func isExtended(name string, def bool) (bool, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return def, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r, err := history.Decompress(f)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if line == "" {
+		return def, nil
+	}
+
+	return strings.HasPrefix(line, history.ColumnTime), nil
+}
+
+func parseInterval(interval string) (ticks int, letter binance.IntervalLetter, err error) {
+	if len(interval) < 2 {
+		return 0, "", fmt.Errorf("bad interval %q", interval)
+	}
+
+	letter = binance.IntervalLetter(interval[len(interval)-1:])
+	switch letter {
+	case binance.IntervalSecond, binance.IntervalMinute, binance.IntervalHour, binance.IntervalDay:
+	default:
+		return 0, "", fmt.Errorf("bad interval %q: unknown unit %q", interval, letter)
+	}
+
+	ticks, err = strconv.Atoi(interval[:len(interval)-1])
+	if err != nil || ticks <= 0 {
+		return 0, "", fmt.Errorf("bad interval %q", interval)
+	}
+
+	return ticks, letter, nil
+}
+
+func split(s string) []string {
+	var result []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
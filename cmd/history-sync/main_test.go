@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/history"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+const (
+	testSymbol platform.Symbol = "BTCUSDT"
+	hour                       = int64(time.Hour / time.Millisecond)
+)
+
+// klinesServer serves hourly klines up to the one in progress,
+// pages following the failAfter ones fail if it is not zero.
+type klinesServer struct {
+	t         *testing.T
+	last      int64
+	failAfter int
+	pages     int
+}
+
+func newKlinesServer(t *testing.T, failAfter int) (*klinesServer, *httptest.Server) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	ks := &klinesServer{
+		t:         t,
+		last:      now/hour*hour - hour,
+		failAfter: failAfter,
+	}
+
+	srv := httptest.NewServer(ks)
+	t.Cleanup(srv.Close)
+
+	return ks, srv
+}
+
+func (ks *klinesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v3/klines" {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("symbol") != string(testSymbol) || q.Get("interval") != "1h" {
+		ks.t.Errorf("unexpected query: %s", r.URL.RawQuery)
+	}
+
+	ks.pages++
+	if ks.failAfter != 0 && ks.pages > ks.failAfter {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	start, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	var rows [][]interface{}
+
+	// The last kline is in progress.
+	for open := (start + hour - 1) / hour * hour; open <= ks.last+hour && len(rows) < limit; open += hour {
+		rows = append(rows, []interface{}{
+			open, "1", "2", "0.5", "1.5", "10",
+			open + hour - 1, "15", 3, "4", "6",
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(rows); err != nil {
+		ks.t.Error(err)
+	}
+}
+
+func writeHistory(t *testing.T, name string, extended bool, times ...int64) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := history.NewWriterWith(f, history.WriterOptions{
+		Extended:    extended,
+		Compression: history.CompressionFromName(name),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range times {
+		err := w.Write(history.OHLCV{
+			Time:      ts,
+			Open:      fixed.NewI(1, 0),
+			High:      fixed.NewI(2, 0),
+			Low:       fixed.NewS("0.5"),
+			Close:     fixed.NewS("1.5"),
+			Volume:    fixed.NewI(10, 0),
+			TimeClose: ts + hour - 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readHistory(t *testing.T, name string) []history.OHLCV {
+	t.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := history.Detect(f, history.ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var candles []history.OHLCV
+	for {
+		c, err := r.Read()
+		if err == io.EOF {
+			return candles
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		candles = append(candles, c)
+	}
+}
+
+func TestSyncResume(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		extended bool
+	}{
+		{"plain", "%s_%s.csv", false},
+		{"gzip", "%s_%s.csv.gz", false},
+		{"extended", "%s_%s.csv", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, srv := newKlinesServer(t, 0)
+
+			opt := Options{
+				Dir:     t.TempDir(),
+				Name:    tt.file,
+				BaseURL: srv.URL,
+			}
+			name := filepath.Join(opt.Dir, fmt.Sprintf(opt.Name, testSymbol, "1h"))
+
+			first := ks.last - 9*hour
+			writeHistory(t, name, tt.extended, first, first+hour, first+2*hour, first+3*hour, first+4*hour)
+
+			n, err := sync(context.Background(), opt, testSymbol, "1h")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The candle in progress is skipped.
+			if n != 5 {
+				t.Errorf("new candles = %d, want 5", n)
+			}
+
+			candles := readHistory(t, name)
+			if len(candles) != 10 {
+				t.Fatalf("candles = %d, want 10", len(candles))
+			}
+			for i, c := range candles {
+				if want := first + int64(i)*hour; c.Time != want {
+					t.Errorf("candle %d time = %d, want %d", i, c.Time, want)
+				}
+			}
+
+			// The extended layout of the file is kept.
+			if c := candles[9]; tt.extended != (c.TimeClose != 0) {
+				t.Errorf("last candle time_close = %d, extended = %v", c.TimeClose, tt.extended)
+			}
+			if tt.extended && candles[9].CountTrades != 3 {
+				t.Errorf("last candle count_trades = %d, want 3", candles[9].CountTrades)
+			}
+		})
+	}
+}
+
+func TestSyncFailureKeepsFile(t *testing.T) {
+	ks, srv := newKlinesServer(t, 1)
+
+	opt := Options{
+		Dir:     t.TempDir(),
+		Name:    "%s_%s.csv",
+		BaseURL: srv.URL,
+	}
+	name := filepath.Join(opt.Dir, fmt.Sprintf(opt.Name, testSymbol, "1h"))
+
+	// Missing klines take more than a page.
+	writeHistory(t, name, false, ks.last-1500*hour)
+
+	before, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sync(context.Background(), opt, testSymbol, "1h"); err == nil {
+		t.Fatal("sync succeeded")
+	}
+	if ks.pages != 2 {
+		t.Errorf("requested pages = %d, want 2", ks.pages)
+	}
+
+	after, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("file is changed:\n%s", after)
+	}
+
+	entries, err := os.ReadDir(opt.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files = %d, want 1", len(entries))
+	}
+}
+
+func TestSyncKeepsMode(t *testing.T) {
+	ks, srv := newKlinesServer(t, 0)
+
+	opt := Options{
+		Dir:     t.TempDir(),
+		Name:    "%s_%s.csv",
+		BaseURL: srv.URL,
+	}
+	name := filepath.Join(opt.Dir, fmt.Sprintf(opt.Name, testSymbol, "1h"))
+
+	writeHistory(t, name, false, ks.last-2*hour)
+	if err := os.Chmod(name, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sync(context.Background(), opt, testSymbol, "1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := st.Mode().Perm(); mode != 0o640 {
+		t.Errorf("mode = %o, want 640", mode)
+	}
+}
@@ -7,12 +7,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"time"
 
 	"github.com/WinPooh32/retrade/candle"
 	"github.com/WinPooh32/retrade/platform"
 	"github.com/WinPooh32/retrade/provider/binance"
 	"github.com/WinPooh32/retrade/provider/file"
+	"github.com/WinPooh32/retrade/provider/merge"
 )
 
 const intervalTicks = 30
@@ -26,14 +26,13 @@ func main() {
 	defer cancel()
 
 	const symbol = "BTCUSDT"
-	const window = 2 * 60
 	const buffer = 60000
 
 	var interval = binance.IntervalFromLetter(intervalTicks, intervalLetter)
 
 	candles := candle.NewCandle(interval, buffer)
 
-	err := fetch(ctx, symbol, window, interval, candles, *offline)
+	err := fetch(ctx, symbol, candles, *offline)
 	if errors.Is(err, context.Canceled) {
 		fmt.Println("interrupted.")
 		return
@@ -46,38 +45,28 @@ func main() {
 	fmt.Println("exit.")
 }
 
-func fetch(ctx context.Context, symbol platform.Symbol, window int, interval int64, candles *candle.Candle, offline bool) error {
-	err := fetchHistoryFile(ctx, symbol, candles)
+func fetch(ctx context.Context, symbol platform.Symbol, candles *candle.Candle, offline bool) error {
+	f, err := file.Open(string(symbol) + ".csv")
 	if err != nil {
-		return fmt.Errorf("fetch history file: %w", err)
+		return fmt.Errorf("open history file: %w", err)
 	}
 
-	err = fetchHistoryBinance(ctx, symbol, window, interval, candles)
-	if err != nil {
-		return fmt.Errorf("fetch history binance: %w", err)
+	// Binance history continues the file and live trades continue the history,
+	// overlapping events are dropped.
+	providers := []platform.Public{
+		f,
+		binance.NewHistory(false, intervalTicks, intervalLetter),
 	}
 
 	if !offline {
-		err = fetchBinance(ctx, symbol, candles)
+		live, err := binance.New(false, "", "")
 		if err != nil {
-			return fmt.Errorf("fetch binance trades: %w", err)
+			return fmt.Errorf("binance: new instance: %w", err)
 		}
+		providers = append(providers, live)
 	}
 
-	return nil
-}
-
-func fetchHistoryFile(ctx context.Context, symbol platform.Symbol, candles *candle.Candle) error {
-	fmt.Println("fetch file history.")
-
-	f, err := file.Open(string(symbol) + ".csv")
-	if err != nil {
-		return fmt.Errorf("open history file: %w", err)
-	}
-
-	historyEvents := f.Subscribe(ctx, symbol)
-
-	for e := range historyEvents {
+	for e := range merge.Concat(providers...).Subscribe(ctx, symbol) {
 		switch e.Type {
 		case platform.EventErr:
 			return fmt.Errorf("event: %w", e.Error)
@@ -91,90 +80,26 @@ func fetchHistoryFile(ctx context.Context, symbol platform.Symbol, candles *cand
 				c.Close,
 				c.Volume,
 			)
-		}
-	}
-	return nil
-}
+		case platform.EventTrade:
+			t := e.Event.Trade
 
-func fetchHistoryBinance(ctx context.Context, symbol platform.Symbol, window int, interval int64, candles *candle.Candle) error {
-	fmt.Println("fetch binance history.")
+			fmt.Printf("%+v\n", t)
 
-	binanceHistory := binance.NewHistory(false, intervalTicks, intervalLetter)
-	binanceHistoryEvents := binanceHistory.Subscribe(ctx, symbol)
-
-	fileLastTs, _, _, _, _, _ := candles.Last()
-
-	for e := range binanceHistoryEvents {
-		switch e.Type {
-		case platform.EventErr:
-			return fmt.Errorf("event: %w", e.Error)
-		case platform.EventCandle:
-			c := e.Event.Candle
-			if c.Time <= fileLastTs {
-				continue
+			if candles.Add(t) {
+				// Print filled candlestick.
+				time, open, high, low, close, volume := candles.Last()
+				fmt.Println("last filled candle:", time, open, high, low, close, volume)
 			}
-			candles.AppendRaw(
-				c.Time,
-				c.Open,
-				c.High,
-				c.Low,
-				c.Close,
-				c.Volume,
-			)
-			time, open, high, low, close, volume := candles.Last()
-			fmt.Println("binance candle:", time, open, high, low, close, volume)
-		}
-	}
+		case platform.EventBookTicker:
+			b := e.Event.BookTicker
 
-	return nil
-}
-
-func fetchBinance(ctx context.Context, symbol platform.Symbol, candles *candle.Candle) error {
-	fmt.Println("fetch binance trades.")
+			fmt.Printf("%+v\n", b)
+		case platform.EventReconnect:
+			r := e.Event.Reconnect
 
-reconnect:
-	for i := 0; i < 5; i++ {
-		fmt.Println("fetch binance.")
-
-		binance, err := binance.New(false, "", "")
-		if err != nil {
-			return fmt.Errorf("binance: new instance: %w", err)
-		}
-
-		binanceEvents := binance.Subscribe(ctx, symbol)
-
-		for e := range binanceEvents {
-			switch e.Type {
-			case platform.EventErr:
-				if e.Error == context.Canceled {
-					return fmt.Errorf("event: %w", e.Error)
-				} else {
-					fmt.Println(e.Error)
-					s := 5 * time.Second
-					fmt.Printf("reconnect in %s\n", s)
-					time.Sleep(s)
-					continue reconnect
-				}
-			case platform.EventTrade:
-				t := e.Event.Trade
-
-				fmt.Printf("%+v\n", t)
-
-				if candles.Add(t) {
-					// Print filled candlestick.
-					time, open, high, low, close, volume := candles.Last()
-					fmt.Println("last filled candle:", time, open, high, low, close, volume)
-				}
-			case platform.EventBookTicker:
-				b := e.Event.BookTicker
-
-				fmt.Printf("%+v\n", b)
-			}
-			// Reset retry counter.
-			if i != 0 {
-				i = 0
-			}
+			fmt.Printf("reconnected after %d attempts: %s, backfilled: %t\n", r.Attempts, r.Reason, r.Backfilled)
 		}
 	}
+
 	return nil
 }
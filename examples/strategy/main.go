@@ -112,5 +112,6 @@ func main() {
 	}
 
 	fmt.Println("pool value:", result.Pool)
+	fmt.Print(result.Report)
 	fmt.Println("exit.")
 }
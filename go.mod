@@ -9,6 +9,8 @@ require (
 	github.com/WinPooh32/series v0.0.8
 	github.com/adshao/go-binance/v2 v2.3.2
 	github.com/hashicorp/go-multierror v1.1.1
+	github.com/klauspost/compress v1.13.1
+	nhooyr.io/websocket v1.8.7
 )
 
 require (
@@ -18,8 +20,7 @@ require (
 
 require (
 	github.com/WinPooh32/math v1.0.5 // indirect
+	github.com/golang/snappy v0.0.3 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
-	github.com/klauspost/compress v1.13.1 // indirect
 	github.com/stretchr/testify v1.7.0 // indirect
-	nhooyr.io/websocket v1.8.7 // indirect
 )
@@ -0,0 +1,212 @@
+package history
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of the history files.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionZip  = "zip"
+)
+
+// zipEntry is the name of the history file written into zip archives.
+const zipEntry = "history.csv"
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip  = []byte{'P', 'K', 0x03, 0x04}
+)
+
+// CompressionFromName detects compression by the file extension.
+func CompressionFromName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	case ".zip":
+		return CompressionZip
+	default:
+		return CompressionNone
+	}
+}
+
+// Decompress detects compression of r by the magic bytes and returns
+// the decompressed stream. Zip archives are read from the first file,
+// they are loaded into memory unless r is a file.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	var start int64 = -1
+
+	if s, ok := r.(io.ReadSeeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			start = pos
+		}
+	}
+
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(magicZip))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("peek magic: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return zr, nil
+
+	case bytes.HasPrefix(magic, magicZstd):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+
+	case bytes.HasPrefix(magic, magicZip):
+		zr, err := openZip(r, br)
+		if err != nil {
+			return nil, fmt.Errorf("zip: %w", err)
+		}
+		return zr, nil
+
+	default:
+		return plain{Reader: br, src: r, start: start}, nil
+	}
+}
+
+// plain is an uncompressed stream, it remembers the start position
+// of the source if it is seekable.
+type plain struct {
+	*bufio.Reader
+	src   io.Reader
+	start int64
+}
+
+func (plain) Close() error { return nil }
+
+func (p plain) seeker() (io.ReadSeeker, int64, bool) {
+	s, ok := p.src.(io.ReadSeeker)
+	return s, p.start, ok && p.start >= 0
+}
+
+// seekerOf returns the seekable source of the uncompressed stream
+// and the start position of the stream in it.
+func seekerOf(rc io.ReadCloser) (io.ReadSeeker, int64, bool) {
+	if r, ok := rc.(readCloser); ok {
+		rc, _ = r.Closer.(io.ReadCloser)
+	}
+	if p, ok := rc.(plain); ok {
+		return p.seeker()
+	}
+	return nil, 0, false
+}
+
+func openZip(r io.Reader, br *bufio.Reader) (io.ReadCloser, error) {
+	var (
+		ra   io.ReaderAt
+		size int64
+	)
+
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("stat: %w", err)
+		}
+		ra, size = f, info.Size()
+	} else {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		return f.Open()
+	}
+
+	return nil, fmt.Errorf("archive is empty")
+}
+
+// Compress returns writer compressing into w.
+// It must be closed to flush the compressed stream, w stays open.
+func Compress(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return zw, nil
+
+	case CompressionZip:
+		zw := zip.NewWriter(w)
+		fw, err := zw.Create(zipEntry)
+		if err != nil {
+			return nil, fmt.Errorf("zip: %w", err)
+		}
+		return zipWriter{Writer: fw, zw: zw}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+type zipWriter struct {
+	io.Writer
+	zw *zip.Writer
+}
+
+func (w zipWriter) Close() error { return w.zw.Close() }
+
+// source is a decompressed stream, it is closed on EOF.
+type source struct{ rc io.ReadCloser }
+
+func (s *source) Close() error {
+	if s.rc == nil {
+		return nil
+	}
+	err := s.rc.Close()
+	s.rc = nil
+	return err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -1,11 +1,65 @@
 package history
 
 import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
 	"github.com/WinPooh32/fixed"
 )
 
-const recordLen = 6
+const (
+	recordLen         = 6
+	extendedRecordLen = 11
+)
 
+// Column names of the history header line in the records order.
+const (
+	ColumnTime                = "time"
+	ColumnOpen                = "open"
+	ColumnHigh                = "high"
+	ColumnLow                 = "low"
+	ColumnClose               = "close"
+	ColumnVolume              = "volume"
+	ColumnTimeClose           = "time_close"
+	ColumnVolumeQuote         = "volume_quote"
+	ColumnCountTrades         = "count_trades"
+	ColumnVolumeTakerBuyBase  = "volume_taker_buy_base"
+	ColumnVolumeTakerBuyQuote = "volume_taker_buy_quote"
+)
+
+var columns = [extendedRecordLen]string{
+	ColumnTime,
+	ColumnOpen,
+	ColumnHigh,
+	ColumnLow,
+	ColumnClose,
+	ColumnVolume,
+	ColumnTimeClose,
+	ColumnVolumeQuote,
+	ColumnCountTrades,
+	ColumnVolumeTakerBuyBase,
+	ColumnVolumeTakerBuyQuote,
+}
+
+// Time units of the history files.
+const (
+	UnitSeconds      = "s"
+	UnitMilliseconds = "ms"
+	UnitMicroseconds = "us"
+	UnitNanoseconds  = "ns"
+	UnitISO8601      = "iso8601"
+)
+
+// OHLCV is a candle record, Time and TimeClose are in milliseconds.
+// CSV history holds times in the TimeUnit of ReaderOptions and WriterOptions,
+// seconds if it is empty: the reader converts the file unit to milliseconds
+// and the writer converts milliseconds back, so file seconds are
+// multiplied by 1000 on read and divided on write.
+// Binary history always holds milliseconds.
+// The extended fields after Volume are optional and stay zero
+// if history does not have them.
 type OHLCV struct {
 	Time int64
 	Open,
@@ -13,6 +67,12 @@ type OHLCV struct {
 	Low,
 	Close,
 	Volume fixed.Fixed
+
+	TimeClose   int64
+	VolumeQuote fixed.Fixed
+	CountTrades int64
+	VolumeTakerBuyBase,
+	VolumeTakerBuyQuote fixed.Fixed
 }
 
 type Writer interface {
@@ -22,3 +82,119 @@ type Writer interface {
 type Reader interface {
 	Read() (t OHLCV, err error)
 }
+
+type ReadCloser interface {
+	Reader
+	io.Closer
+}
+
+const (
+	tradeRecordLen      = 5
+	bookTickerRecordLen = 6
+)
+
+// Trade is a tick record, time is in milliseconds.
+type Trade struct {
+	TradeID      int64
+	Time         int64
+	Price        fixed.Fixed
+	Quantity     fixed.Fixed
+	IsBuyerMaker bool
+}
+
+// BookTicker is a best bid and ask record, time is in milliseconds.
+type BookTicker struct {
+	Time         int64
+	UpdateID     string
+	BestBidPrice fixed.Fixed
+	BestBidQty   fixed.Fixed
+	BestAskPrice fixed.Fixed
+	BestAskQty   fixed.Fixed
+}
+
+type TradeWriter interface {
+	WriteTrade(t Trade) (err error)
+}
+
+type TradeReader interface {
+	ReadTrade() (t Trade, err error)
+}
+
+type BookTickerWriter interface {
+	WriteBookTicker(b BookTicker) (err error)
+}
+
+type BookTickerReader interface {
+	ReadBookTicker() (b BookTicker, err error)
+}
+
+func validUnit(unit string) bool {
+	switch unit {
+	case "", UnitSeconds, UnitMilliseconds, UnitMicroseconds, UnitNanoseconds, UnitISO8601:
+		return true
+	default:
+		return false
+	}
+}
+
+func parseTime(s string, unit string) (int64, error) {
+	if unit == UnitISO8601 {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return 0, err
+		}
+		return t.UnixNano() / int64(time.Millisecond), nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch unit {
+	case UnitSeconds, "":
+		return v * 1000, nil
+	case UnitMilliseconds:
+		return v, nil
+	case UnitMicroseconds:
+		return v / 1000, nil
+	case UnitNanoseconds:
+		return v / 1000000, nil
+	default:
+		return 0, fmt.Errorf("unknown time unit %q", unit)
+	}
+}
+
+func formatTime(ms int64, unit string) (string, error) {
+	switch unit {
+	case UnitSeconds, "":
+		return strconv.FormatInt(ms/1000, 10), nil
+	case UnitMilliseconds:
+		return strconv.FormatInt(ms, 10), nil
+	case UnitMicroseconds:
+		return strconv.FormatInt(ms*1000, 10), nil
+	case UnitNanoseconds:
+		return strconv.FormatInt(ms*1000000, 10), nil
+	case UnitISO8601:
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano), nil
+	default:
+		return "", fmt.Errorf("unknown time unit %q", unit)
+	}
+}
+
+// Last reads r to the end and returns the last record.
+// It returns io.EOF if there are no records.
+func Last(r Reader) (last OHLCV, err error) {
+	err = io.EOF
+
+	for {
+		t, rerr := r.Read()
+		if rerr == io.EOF {
+			return last, err
+		}
+		if rerr != nil {
+			return last, rerr
+		}
+		last, err = t, nil
+	}
+}
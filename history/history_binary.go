@@ -0,0 +1,247 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/WinPooh32/fixed"
+)
+
+// Binary history starts with a header followed by fixed-width records
+// of little-endian int64 time in milliseconds and raw fixed values of OHLCV.
+//
+// Header layout:
+//
+//	magic    [4]byte "RTHB"
+//	version  uint16
+//	interval int64
+//	length   uint8
+//	symbol   [length]byte
+const (
+	BinaryVersion = 1
+
+	binaryRecordLen = 8 * recordLen
+)
+
+var binaryMagic = []byte("RTHB")
+
+var (
+	ErrBinaryHeader = fmt.Errorf("bad binary history header")
+	ErrNotSeekable  = fmt.Errorf("history is not seekable")
+)
+
+type BinaryHeader struct {
+	Version  uint16
+	Symbol   string
+	Interval int64
+}
+
+type BinaryReader struct {
+	source
+
+	r      *bufio.Reader
+	header BinaryHeader
+	buf    [binaryRecordLen]byte
+
+	// seeker is set for uncompressed seekable sources,
+	// records start at the offset.
+	seeker io.ReadSeeker
+	offset int64
+}
+
+func NewBinaryReader(r io.Reader) (*BinaryReader, error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	return newBinaryReader(bufio.NewReader(rc), rc)
+}
+
+func newBinaryReader(r *bufio.Reader, rc io.ReadCloser) (*BinaryReader, error) {
+	br := &BinaryReader{
+		source: source{rc},
+		r:      r,
+	}
+
+	var head [4 + 2 + 8 + 1]byte
+
+	if _, err := io.ReadFull(br.r, head[:]); err != nil {
+		br.Close()
+		return nil, fmt.Errorf("%w: %s", ErrBinaryHeader, err)
+	}
+	if !bytes.Equal(head[:4], binaryMagic) {
+		br.Close()
+		return nil, fmt.Errorf("%w: wrong magic %q", ErrBinaryHeader, head[:4])
+	}
+
+	br.header.Version = binary.LittleEndian.Uint16(head[4:])
+	if br.header.Version != BinaryVersion {
+		br.Close()
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBinaryHeader, br.header.Version)
+	}
+
+	br.header.Interval = int64(binary.LittleEndian.Uint64(head[6:]))
+
+	symbol := make([]byte, head[14])
+	if _, err := io.ReadFull(br.r, symbol); err != nil {
+		br.Close()
+		return nil, fmt.Errorf("%w: symbol: %s", ErrBinaryHeader, err)
+	}
+	br.header.Symbol = string(symbol)
+
+	if s, start, ok := seekerOf(rc); ok {
+		br.seeker = s
+		br.offset = start + int64(len(head)) + int64(len(symbol))
+	}
+
+	return br, nil
+}
+
+// SeekTime moves to the first record with time not less than t
+// using binary search, records must be sorted by time.
+func (br *BinaryReader) SeekTime(t int64) error {
+	if br.seeker == nil {
+		return ErrNotSeekable
+	}
+
+	end, err := br.seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("seek end: %w", err)
+	}
+
+	var (
+		n    = (end - br.offset) / binaryRecordLen
+		serr error
+		buf  [8]byte
+	)
+
+	i := sort.Search(int(n), func(i int) bool {
+		if serr != nil {
+			return true
+		}
+		if _, serr = br.seeker.Seek(br.offset+int64(i)*binaryRecordLen, io.SeekStart); serr != nil {
+			return true
+		}
+		if _, serr = io.ReadFull(br.seeker, buf[:]); serr != nil {
+			return true
+		}
+		return int64(binary.LittleEndian.Uint64(buf[:])) >= t
+	})
+	if serr != nil {
+		return fmt.Errorf("search: %w", serr)
+	}
+
+	if _, err := br.seeker.Seek(br.offset+int64(i)*binaryRecordLen, io.SeekStart); err != nil {
+		return fmt.Errorf("seek record %d: %w", i, err)
+	}
+	br.r.Reset(br.seeker)
+
+	return nil
+}
+
+func (br *BinaryReader) Header() BinaryHeader {
+	return br.header
+}
+
+func (br *BinaryReader) Read() (t OHLCV, err error) {
+	_, err = io.ReadFull(br.r, br.buf[:])
+	if err == io.EOF {
+		br.Close()
+		return t, err
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return t, fmt.Errorf("read binary record: truncated: %w", err)
+	}
+	if err != nil {
+		return t, fmt.Errorf("read binary record: %w", err)
+	}
+
+	b := br.buf[:]
+
+	t.Time = int64(binary.LittleEndian.Uint64(b[0:]))
+	t.Open = fixed.NewRaw(int64(binary.LittleEndian.Uint64(b[8:])))
+	t.High = fixed.NewRaw(int64(binary.LittleEndian.Uint64(b[16:])))
+	t.Low = fixed.NewRaw(int64(binary.LittleEndian.Uint64(b[24:])))
+	t.Close = fixed.NewRaw(int64(binary.LittleEndian.Uint64(b[32:])))
+	t.Volume = fixed.NewRaw(int64(binary.LittleEndian.Uint64(b[40:])))
+
+	return t, nil
+}
+
+// BinaryWriter buffers records, Flush must be called after the last write.
+type BinaryWriter struct {
+	w   *bufio.Writer
+	buf [binaryRecordLen]byte
+}
+
+func NewBinaryWriter(w io.Writer, header BinaryHeader) (*BinaryWriter, error) {
+	if len(header.Symbol) > 255 {
+		return nil, fmt.Errorf("symbol %q is too long", header.Symbol)
+	}
+
+	bw := &BinaryWriter{
+		w: bufio.NewWriter(w),
+	}
+
+	var head [4 + 2 + 8 + 1]byte
+
+	copy(head[:4], binaryMagic)
+	binary.LittleEndian.PutUint16(head[4:], BinaryVersion)
+	binary.LittleEndian.PutUint64(head[6:], uint64(header.Interval))
+	head[14] = byte(len(header.Symbol))
+
+	if _, err := bw.w.Write(head[:]); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	if _, err := bw.w.WriteString(header.Symbol); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+
+	return bw, nil
+}
+
+func (bw *BinaryWriter) Write(t OHLCV) (err error) {
+	b := bw.buf[:]
+
+	binary.LittleEndian.PutUint64(b[0:], uint64(t.Time))
+	binary.LittleEndian.PutUint64(b[8:], uint64(t.Open.Raw()))
+	binary.LittleEndian.PutUint64(b[16:], uint64(t.High.Raw()))
+	binary.LittleEndian.PutUint64(b[24:], uint64(t.Low.Raw()))
+	binary.LittleEndian.PutUint64(b[32:], uint64(t.Close.Raw()))
+	binary.LittleEndian.PutUint64(b[40:], uint64(t.Volume.Raw()))
+
+	_, err = bw.w.Write(b)
+	return err
+}
+
+func (bw *BinaryWriter) Flush() error {
+	return bw.w.Flush()
+}
+
+// Detect returns binary reader if r starts with the binary history magic
+// and CSV reader with the options otherwise. Compression is detected before.
+func Detect(r io.Reader, opt ReaderOptions) (ReadCloser, error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+
+	br := bufio.NewReader(rc)
+
+	magic, err := br.Peek(len(binaryMagic))
+	if err != nil && err != io.EOF {
+		rc.Close()
+		return nil, fmt.Errorf("peek magic: %w", err)
+	}
+
+	if bytes.Equal(magic, binaryMagic) {
+		return newBinaryReader(br, rc)
+	}
+
+	return newReaderWith(readCloser{br, rc}, opt)
+}
@@ -0,0 +1,115 @@
+package history
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+)
+
+// writeBinary writes candles with the times and sets the version of the header.
+func writeBinary(t *testing.T, version uint16, times ...int64) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "history.bin")
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	bw, err := NewBinaryWriter(f, BinaryHeader{Symbol: "BTCUSDT", Interval: 60000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ts := range times {
+		if err := bw.Write(OHLCV{Time: ts, Close: fixed.NewI(int64(i), 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var v [2]byte
+	binary.LittleEndian.PutUint16(v[:], version)
+	if _, err := f.WriteAt(v[:], 4); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func readTimes(t *testing.T, name string, seek int64) (header BinaryHeader, times []int64) {
+	t.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	br, err := NewBinaryReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seek != 0 {
+		if err := br.SeekTime(seek); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for {
+		c, err := br.Read()
+		if err == io.EOF {
+			return br.Header(), times
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, c.Time)
+	}
+}
+
+func equalTimes(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBinaryMilliseconds(t *testing.T) {
+	name := writeBinary(t, BinaryVersion, 60000, 120000, 180000)
+
+	header, times := readTimes(t, name, 120000)
+
+	if header.Version != BinaryVersion || header.Symbol != "BTCUSDT" || header.Interval != 60000 {
+		t.Errorf("header = %+v", header)
+	}
+	if want := []int64{120000, 180000}; !equalTimes(times, want) {
+		t.Errorf("times = %v, want %v", times, want)
+	}
+}
+
+func TestBinaryUnsupportedVersion(t *testing.T) {
+	name := writeBinary(t, BinaryVersion+1, 60000)
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := NewBinaryReader(f); err == nil {
+		t.Fatal("unsupported version is read")
+	}
+}
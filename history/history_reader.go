@@ -1,72 +1,402 @@
 package history
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/WinPooh32/fixed"
 	"github.com/hashicorp/go-multierror"
 )
 
+type ReaderOptions struct {
+	// Comma is the fields delimiter, ',' if zero.
+	Comma rune
+	// Comment starts lines to be skipped if it is not zero.
+	Comment rune
+	// TimeUnit of the time columns, seconds if empty.
+	// Times are converted to milliseconds of OHLCV.
+	TimeUnit string
+	// Columns maps the column names (ColumnTime, ColumnOpen, ...)
+	// to the names used by the file header. The header line is required
+	// if it is not empty, unmapped columns keep their default names.
+	Columns map[string]string
+}
+
+// HistoryReader reads CSV candles. The columns layout is detected
+// from the first line: it is either a header line with column names
+// or a record of six OHLCV columns optionally followed by the extended ones.
+//
+// Compressed input is detected by NewReader and decompressed on the fly.
+// It is closed on EOF, Close releases it before that.
 type HistoryReader struct {
+	source
+
 	r     *csv.Reader
+	opt   ReaderOptions
 	count int
+
+	// layout maps fields to the record columns, -1 marks missing fields.
+	layout []int
+	fields int
+
+	// seeker is set for uncompressed seekable sources,
+	// the history starts at the offset.
+	seeker io.ReadSeeker
+	offset int64
 }
 
 func NewReader(r io.Reader) (*HistoryReader, error) {
+	return NewReaderWith(r, ReaderOptions{})
+}
+
+func NewReaderWith(r io.Reader, opt ReaderOptions) (*HistoryReader, error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	return newReaderWith(rc, opt)
+}
+
+func newReaderWith(rc io.ReadCloser, opt ReaderOptions) (*HistoryReader, error) {
+	if opt.Comma == 0 {
+		opt.Comma = ','
+	}
+	if !validUnit(opt.TimeUnit) {
+		rc.Close()
+		return nil, fmt.Errorf("unknown time unit %q", opt.TimeUnit)
+	}
+	for name := range opt.Columns {
+		if columnIndex(name) < 0 {
+			rc.Close()
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	hr := &HistoryReader{
+		source: source{rc},
+		opt:    opt,
+	}
+	hr.r = hr.csvReader(rc)
+
+	if s, start, ok := seekerOf(rc); ok {
+		hr.seeker = s
+		hr.offset = start
+	}
+
+	return hr, nil
+}
+
+func (hr *HistoryReader) csvReader(r io.Reader) *csv.Reader {
 	rcsv := csv.NewReader(r)
-	rcsv.Comma = ','
+	rcsv.Comma = hr.opt.Comma
+	rcsv.Comment = hr.opt.Comment
 	rcsv.ReuseRecord = true
-
-	return &HistoryReader{
-		r: rcsv,
-	}, nil
+	return rcsv
 }
 
 func (hr *HistoryReader) Read() (t OHLCV, err error) {
 	const (
-		Time   = 0
-		Open   = 1
-		High   = 2
-		Low    = 3
-		Close  = 4
-		Volume = 5
+		Time                = 0
+		Open                = 1
+		High                = 2
+		Low                 = 3
+		Close               = 4
+		Volume              = 5
+		TimeClose           = 6
+		VolumeQuote         = 7
+		CountTrades         = 8
+		VolumeTakerBuyBase  = 9
+		VolumeTakerBuyQuote = 10
 	)
 
+	record, err := hr.read()
+	if err != nil {
+		return t, err
+	}
+
+	if hr.layout == nil {
+		header, err := hr.setLayout(record)
+		if err != nil {
+			return t, fmt.Errorf("record on line %d: %w", hr.count, err)
+		}
+
+		if header {
+			record, err = hr.read()
+			if err != nil {
+				return t, err
+			}
+		}
+	}
+
+	if len(record) < hr.fields {
+		return t, fmt.Errorf("record on line %d: wrong number of fields %d, expected not less than %d", hr.count, len(record), hr.fields)
+	}
+
+	var merr *multierror.Error
+
+	parseMillis := func(field int) (v int64) {
+		if i := hr.layout[field]; i >= 0 {
+			v, err = parseTime(record[i], hr.opt.TimeUnit)
+			merr = multierror.Append(merr, err)
+		}
+		return v
+	}
+
+	parseInt := func(field int) (v int64) {
+		if i := hr.layout[field]; i >= 0 {
+			v, err = strconv.ParseInt(record[i], 10, 64)
+			merr = multierror.Append(merr, err)
+		}
+		return v
+	}
+
+	parseFixed := func(field int) (v fixed.Fixed) {
+		v = fixed.ZERO
+		if i := hr.layout[field]; i >= 0 {
+			v, err = fixed.NewSErr(record[i])
+			merr = multierror.Append(merr, err)
+		}
+		return v
+	}
+
+	t.Time = parseMillis(Time)
+	t.Open = parseFixed(Open)
+	t.High = parseFixed(High)
+	t.Low = parseFixed(Low)
+	t.Close = parseFixed(Close)
+	t.Volume = parseFixed(Volume)
+	t.TimeClose = parseMillis(TimeClose)
+	t.VolumeQuote = parseFixed(VolumeQuote)
+	t.CountTrades = parseInt(CountTrades)
+	t.VolumeTakerBuyBase = parseFixed(VolumeTakerBuyBase)
+	t.VolumeTakerBuyQuote = parseFixed(VolumeTakerBuyQuote)
+
+	return t, merr.ErrorOrNil()
+}
+
+func (hr *HistoryReader) read() ([]string, error) {
 	hr.count++
 
 	record, err := hr.r.Read()
 	if err == io.EOF {
-		return t, err
+		hr.Close()
+		return nil, err
 	}
 	if err != nil {
-		return t, fmt.Errorf("read csv record: %w", err)
+		return nil, fmt.Errorf("read csv record: %w", err)
 	}
-	if len(record) < recordLen {
-		return t, fmt.Errorf("record on line %d: wrong number of fields %d, expected not less than %d", hr.count, len(record), recordLen)
+	return record, nil
+}
+
+// SeekTime moves to the first record with time not less than t
+// using binary search over the lines, records must be sorted by time.
+// Only uncompressed seekable sources can be searched.
+func (hr *HistoryReader) SeekTime(t int64) error {
+	if hr.seeker == nil {
+		return ErrNotSeekable
 	}
 
-	var merr *multierror.Error
+	first, _, next, err := hr.lineAt(hr.offset)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("first line: %w", err)
+	}
 
-	t.Time, err = strconv.ParseInt(record[Time], 10, 64)
-	merr = multierror.Append(merr, err)
+	header := isHeader(first)
+	if hr.layout == nil {
+		if header, err = hr.setLayout(first); err != nil {
+			return fmt.Errorf("first line: %w", err)
+		}
+	}
 
-	t.Open, err = fixed.NewSErr(record[Open])
-	merr = multierror.Append(merr, err)
+	var start = hr.offset
+	if header {
+		start = next
+	}
 
-	t.High, err = fixed.NewSErr(record[High])
-	merr = multierror.Append(merr, err)
+	end, err := hr.seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("seek end: %w", err)
+	}
 
-	t.Low, err = fixed.NewSErr(record[Low])
-	merr = multierror.Append(merr, err)
+	var serr error
 
-	t.Close, err = fixed.NewSErr(record[Close])
-	merr = multierror.Append(merr, err)
+	i := sort.Search(int(end-start)+1, func(i int) bool {
+		if serr != nil {
+			return true
+		}
+		record, _, _, err := hr.lineAt(start + int64(i))
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			serr = err
+			return true
+		}
+		if len(record) < hr.fields {
+			serr = fmt.Errorf("wrong number of fields %d, expected not less than %d", len(record), hr.fields)
+			return true
+		}
+		ts, err := parseTime(record[hr.layout[0]], hr.opt.TimeUnit)
+		if err != nil {
+			serr = err
+			return true
+		}
+		return ts >= t
+	})
+	if serr != nil {
+		return fmt.Errorf("search: %w", serr)
+	}
 
-	t.Volume, err = fixed.NewSErr(record[Volume])
-	merr = multierror.Append(merr, err)
+	_, at, _, err := hr.lineAt(start + int64(i))
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("search: %w", err)
+	}
 
-	return t, merr.ErrorOrNil()
+	if _, err := hr.seeker.Seek(at, io.SeekStart); err != nil {
+		return fmt.Errorf("seek line: %w", err)
+	}
+	hr.r = hr.csvReader(bufio.NewReader(hr.seeker))
+
+	return nil
+}
+
+// lineAt parses the first record starting at or after the offset, comment
+// and empty lines are skipped. It returns offsets of the record line and
+// of the line following it, the end offset is returned with io.EOF.
+func (hr *HistoryReader) lineAt(offset int64) (record []string, at, next int64, err error) {
+	var pos = offset
+
+	if offset > hr.offset {
+		pos--
+	}
+	if _, err := hr.seeker.Seek(pos, io.SeekStart); err != nil {
+		return nil, 0, 0, err
+	}
+
+	r := bufio.NewReader(hr.seeker)
+
+	// Skip the rest of the line unless the offset is at the line start.
+	if offset > hr.offset {
+		skip, err := r.ReadString('\n')
+		pos += int64(len(skip))
+		if err == io.EOF {
+			return nil, pos, pos, io.EOF
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil, pos, pos, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, 0, 0, err
+		}
+
+		at, pos = pos, pos+int64(len(line))
+
+		// Comment and empty lines are read as EOF.
+		record, err = hr.csvReader(strings.NewReader(line)).Read()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("parse line at offset %d: %w", at, err)
+		}
+
+		return record, at, pos, nil
+	}
+}
+
+// setLayout detects the columns layout by the first record
+// and reports whether the record is a header line.
+func (hr *HistoryReader) setLayout(record []string) (header bool, err error) {
+	header = isHeader(record)
+
+	if !header && len(hr.opt.Columns) > 0 {
+		return false, fmt.Errorf("header is expected")
+	}
+
+	hr.layout, err = hr.detectLayout(record, header)
+	if err != nil {
+		return false, err
+	}
+
+	for _, i := range hr.layout {
+		if i+1 > hr.fields {
+			hr.fields = i + 1
+		}
+	}
+
+	return header, nil
+}
+
+func (hr *HistoryReader) detectLayout(record []string, header bool) ([]int, error) {
+	layout := make([]int, extendedRecordLen)
+
+	if !header {
+		for i := range layout {
+			layout[i] = -1
+			if len(record) >= extendedRecordLen || i < recordLen {
+				layout[i] = i
+			}
+		}
+		return layout, nil
+	}
+
+	index := make(map[string]int, len(record))
+	for i, name := range record {
+		index[normalize(name)] = i
+	}
+
+	for field, name := range columns {
+		if mapped, ok := hr.opt.Columns[name]; ok {
+			name = mapped
+		}
+
+		i, ok := index[normalize(name)]
+		if !ok {
+			if field < recordLen {
+				return nil, fmt.Errorf("header has no column %q", name)
+			}
+			i = -1
+		}
+		layout[field] = i
+	}
+
+	return layout, nil
+}
+
+// isHeader reports whether none of the fields is a number.
+func isHeader(record []string) bool {
+	for _, field := range record {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func columnIndex(name string) int {
+	for i, c := range columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
 }
@@ -0,0 +1,111 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "history.csv")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func seekCSV(t *testing.T, name string, opt ReaderOptions, seek int64) ([]int64, error) {
+	t.Helper()
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := Detect(f, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.(*HistoryReader).SeekTime(seek); err != nil {
+		return nil, err
+	}
+
+	var times []int64
+	for {
+		c, err := r.Read()
+		if err == io.EOF {
+			return times, nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, c.Time)
+	}
+}
+
+func TestHistoryReaderSeekTime(t *testing.T) {
+	const rows = "60,1,2,0.5,1.5,10\n" +
+		"120,1,2,0.5,1.5,10\n" +
+		"# gap\n" +
+		"\n" +
+		"180,1,2,0.5,1.5,10\n" +
+		"240,1,2,0.5,1.5,10\n"
+
+	tests := []struct {
+		name string
+		data string
+		opt  ReaderOptions
+		seek int64
+		want []int64
+	}{
+		{"headerless", rows, ReaderOptions{Comment: '#'}, 120000, []int64{120000, 180000, 240000}},
+		{"between", rows, ReaderOptions{Comment: '#'}, 150000, []int64{180000, 240000}},
+		{"before", rows, ReaderOptions{Comment: '#'}, 1, []int64{60000, 120000, 180000, 240000}},
+		{"after", rows, ReaderOptions{Comment: '#'}, 300000, nil},
+		{"header", "time,open,high,low,close,volume\n" + rows, ReaderOptions{Comment: '#'}, 180000, []int64{180000, 240000}},
+		{
+			"milliseconds",
+			"time,open,high,low,close,volume\r\n60000,1,2,0.5,1.5,10\r\n120000,1,2,0.5,1.5,10\r\n",
+			ReaderOptions{TimeUnit: UnitMilliseconds},
+			100000,
+			[]int64{120000},
+		},
+		{"empty", "", ReaderOptions{}, 100000, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times, err := seekCSV(t, writeFile(t, []byte(tt.data)), tt.opt, tt.seek)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalTimes(times, tt.want) {
+				t.Errorf("times = %v, want %v", times, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryReaderSeekTimeCompressed(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte("60,1,2,0.5,1.5,10\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := seekCSV(t, writeFile(t, buf.Bytes()), ReaderOptions{}, 60000)
+	if !errors.Is(err, ErrNotSeekable) {
+		t.Fatalf("err = %v, want %v", err, ErrNotSeekable)
+	}
+}
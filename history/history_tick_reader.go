@@ -0,0 +1,147 @@
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/hashicorp/go-multierror"
+)
+
+type tickReader struct {
+	source
+
+	r     *csv.Reader
+	count int
+}
+
+func newTickReader(r io.Reader) (tickReader, error) {
+	rc, err := Decompress(r)
+	if err != nil {
+		return tickReader{}, fmt.Errorf("decompress: %w", err)
+	}
+
+	rcsv := csv.NewReader(rc)
+	rcsv.Comma = ','
+	rcsv.ReuseRecord = true
+
+	return tickReader{
+		source: source{rc},
+		r:      rcsv,
+	}, nil
+}
+
+func (tr *tickReader) read(recordLen int) ([]string, error) {
+	tr.count++
+
+	record, err := tr.r.Read()
+	if err == io.EOF {
+		tr.Close()
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read csv record: %w", err)
+	}
+	if len(record) < recordLen {
+		return nil, fmt.Errorf("record on line %d: wrong number of fields %d, expected not less than %d", tr.count, len(record), recordLen)
+	}
+
+	return record, nil
+}
+
+// TradeHistoryReader reads trades in the columns order:
+// trade id, time, price, quantity, buyer is maker.
+type TradeHistoryReader struct{ tickReader }
+
+func NewTradeReader(r io.Reader) (*TradeHistoryReader, error) {
+	tr, err := newTickReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &TradeHistoryReader{tr}, nil
+}
+
+func (tr *TradeHistoryReader) ReadTrade() (t Trade, err error) {
+	const (
+		TradeID      = 0
+		Time         = 1
+		Price        = 2
+		Quantity     = 3
+		IsBuyerMaker = 4
+	)
+
+	record, err := tr.read(tradeRecordLen)
+	if err != nil {
+		return t, err
+	}
+
+	var merr *multierror.Error
+
+	t.TradeID, err = strconv.ParseInt(record[TradeID], 10, 64)
+	merr = multierror.Append(merr, err)
+
+	t.Time, err = strconv.ParseInt(record[Time], 10, 64)
+	merr = multierror.Append(merr, err)
+
+	t.Price, err = fixed.NewSErr(record[Price])
+	merr = multierror.Append(merr, err)
+
+	t.Quantity, err = fixed.NewSErr(record[Quantity])
+	merr = multierror.Append(merr, err)
+
+	t.IsBuyerMaker, err = strconv.ParseBool(record[IsBuyerMaker])
+	merr = multierror.Append(merr, err)
+
+	return t, merr.ErrorOrNil()
+}
+
+// BookTickerHistoryReader reads book tickers in the columns order:
+// time, update id, best bid price, best bid quantity, best ask price, best ask quantity.
+type BookTickerHistoryReader struct{ tickReader }
+
+func NewBookTickerReader(r io.Reader) (*BookTickerHistoryReader, error) {
+	tr, err := newTickReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &BookTickerHistoryReader{tr}, nil
+}
+
+func (br *BookTickerHistoryReader) ReadBookTicker() (b BookTicker, err error) {
+	const (
+		Time         = 0
+		UpdateID     = 1
+		BestBidPrice = 2
+		BestBidQty   = 3
+		BestAskPrice = 4
+		BestAskQty   = 5
+	)
+
+	record, err := br.read(bookTickerRecordLen)
+	if err != nil {
+		return b, err
+	}
+
+	var merr *multierror.Error
+
+	b.Time, err = strconv.ParseInt(record[Time], 10, 64)
+	merr = multierror.Append(merr, err)
+
+	b.UpdateID = record[UpdateID]
+
+	b.BestBidPrice, err = fixed.NewSErr(record[BestBidPrice])
+	merr = multierror.Append(merr, err)
+
+	b.BestBidQty, err = fixed.NewSErr(record[BestBidQty])
+	merr = multierror.Append(merr, err)
+
+	b.BestAskPrice, err = fixed.NewSErr(record[BestAskPrice])
+	merr = multierror.Append(merr, err)
+
+	b.BestAskQty, err = fixed.NewSErr(record[BestAskQty])
+	merr = multierror.Append(merr, err)
+
+	return b, merr.ErrorOrNil()
+}
@@ -0,0 +1,36 @@
+package history
+
+import (
+	"fmt"
+	"io"
+)
+
+type TradeHistoryWriter struct {
+	w io.Writer
+}
+
+func NewTradeWriter(w io.Writer) (*TradeHistoryWriter, error) {
+	return &TradeHistoryWriter{
+		w: w,
+	}, nil
+}
+
+func (tw *TradeHistoryWriter) WriteTrade(t Trade) (err error) {
+	_, err = fmt.Fprintf(tw.w, "%d,%d,%s,%s,%t\n", t.TradeID, t.Time, t.Price, t.Quantity, t.IsBuyerMaker)
+	return err
+}
+
+type BookTickerHistoryWriter struct {
+	w io.Writer
+}
+
+func NewBookTickerWriter(w io.Writer) (*BookTickerHistoryWriter, error) {
+	return &BookTickerHistoryWriter{
+		w: w,
+	}, nil
+}
+
+func (bw *BookTickerHistoryWriter) WriteBookTicker(b BookTicker) (err error) {
+	_, err = fmt.Fprintf(bw.w, "%d,%s,%s,%s,%s,%s\n", b.Time, b.UpdateID, b.BestBidPrice, b.BestBidQty, b.BestAskPrice, b.BestAskQty)
+	return err
+}
@@ -3,21 +3,98 @@ package history
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
+type WriterOptions struct {
+	// Comma is the fields delimiter, ',' if zero.
+	Comma rune
+	// TimeUnit of the time columns, seconds if empty.
+	// OHLCV times are milliseconds and are converted to the unit.
+	TimeUnit string
+	// Extended writes a header line and all OHLCV columns
+	// including the extended ones.
+	Extended bool
+	// Compression of the output, see CompressionFromName.
+	Compression string
+	// Append skips the header line to continue an existing history.
+	Append bool
+}
+
+// HistoryWriter must be closed to flush compressed output,
+// the underlying writer stays open.
 type HistoryWriter struct {
-	w      io.Writer
+	w      io.WriteCloser
+	opt    WriterOptions
+	comma  string
 	record []string
 }
 
 func NewWriter(w io.Writer) (*HistoryWriter, error) {
-	return &HistoryWriter{
-		w:      w,
-		record: make([]string, recordLen),
-	}, nil
+	return NewWriterWith(w, WriterOptions{})
+}
+
+func NewExtendedWriter(w io.Writer) (*HistoryWriter, error) {
+	return NewWriterWith(w, WriterOptions{Extended: true})
+}
+
+func NewWriterWith(w io.Writer, opt WriterOptions) (*HistoryWriter, error) {
+	if opt.Comma == 0 {
+		opt.Comma = ','
+	}
+	if !validUnit(opt.TimeUnit) {
+		return nil, fmt.Errorf("unknown time unit %q", opt.TimeUnit)
+	}
+
+	cw, err := Compress(w, opt.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+
+	fw := &HistoryWriter{
+		w:      cw,
+		opt:    opt,
+		comma:  string(opt.Comma),
+		record: make([]string, 0, extendedRecordLen),
+	}
+
+	if opt.Extended && !opt.Append {
+		_, err := fmt.Fprintln(fw.w, strings.Join(columns[:], fw.comma))
+		if err != nil {
+			return nil, fmt.Errorf("write header: %w", err)
+		}
+	}
+
+	return fw, nil
 }
 
 func (fw *HistoryWriter) Write(t OHLCV) (err error) {
-	_, err = fmt.Fprintf(fw.w, "%d,%s,%s,%s,%s,%s\n", t.Time, t.Open, t.High, t.Low, t.Close, t.Volume)
+	ts, err := formatTime(t.Time, fw.opt.TimeUnit)
+	if err != nil {
+		return err
+	}
+
+	r := append(fw.record[:0], ts, t.Open.String(), t.High.String(), t.Low.String(), t.Close.String(), t.Volume.String())
+
+	if fw.opt.Extended {
+		tsClose, err := formatTime(t.TimeClose, fw.opt.TimeUnit)
+		if err != nil {
+			return err
+		}
+		r = append(r,
+			tsClose,
+			t.VolumeQuote.String(),
+			strconv.FormatInt(t.CountTrades, 10),
+			t.VolumeTakerBuyBase.String(),
+			t.VolumeTakerBuyQuote.String(),
+		)
+	}
+
+	_, err = fmt.Fprintln(fw.w, strings.Join(r, fw.comma))
 	return err
 }
+
+func (fw *HistoryWriter) Close() error {
+	return fw.w.Close()
+}
@@ -0,0 +1,236 @@
+package optimize
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/WinPooh32/retrade/backtest"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+type Factory func(params Params) backtest.OrderStrategy
+
+// Signals makes Factory of boolean strategies.
+func Signals(factory func(params Params) backtest.Strategy, opt backtest.Options) Factory {
+	return func(params Params) backtest.OrderStrategy {
+		return backtest.NewSignalStrategy(factory(params), opt)
+	}
+}
+
+type Objective func(report backtest.Report) float64
+
+func NetReturn(report backtest.Report) float64 { return report.TotalReturn }
+
+func AnnualReturn(report backtest.Report) float64 { return report.AnnualReturn }
+
+func Sharpe(report backtest.Report) float64 { return report.Sharpe }
+
+func Sortino(report backtest.Report) float64 { return report.Sortino }
+
+func ProfitFactor(report backtest.Report) float64 { return report.ProfitFactor }
+
+type Options struct {
+	Backtest backtest.Options
+	// Exchange simulates execution of orders. If it is zero, the exchange
+	// is made of Backtest like the runner does for providers without one:
+	// markets of Backtest, wallet of Account in the quote asset and fees
+	// of FeeBuy and FeeSell.
+	Exchange  backtest.ExchangeOptions
+	Objective Objective
+	Workers   int
+}
+
+var ErrEmptyWallet = fmt.Errorf("exchange wallet is empty")
+
+type Trial struct {
+	Params Params
+	Result backtest.Result
+	Score  float64
+}
+
+type Optimizer struct {
+	opt    Options
+	events map[platform.Symbol][]platform.EventContainer
+}
+
+// New loads whole event streams of the traded symbols into memory,
+// so every trial replays them without touching the provider again.
+func New(ctx context.Context, public platform.Public, opt Options) (*Optimizer, error) {
+	var events = map[platform.Symbol][]platform.EventContainer{}
+
+	for _, symbol := range opt.Backtest.Symbols() {
+		stream, err := load(ctx, public, symbol)
+		if err != nil {
+			return nil, fmt.Errorf("load events of symbol=%s: %w", symbol, err)
+		}
+		events[symbol] = stream
+	}
+
+	return NewWithEvents(events, opt), nil
+}
+
+func NewWithEvents(events map[platform.Symbol][]platform.EventContainer, opt Options) *Optimizer {
+	if opt.Objective == nil {
+		opt.Objective = NetReturn
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = runtime.NumCPU()
+	}
+	return &Optimizer{
+		opt:    opt,
+		events: events,
+	}
+}
+
+func (o *Optimizer) Events() map[platform.Symbol][]platform.EventContainer {
+	return o.events
+}
+
+func (o *Optimizer) Grid(ctx context.Context, space Space, factory Factory) ([]Trial, error) {
+	return o.Search(ctx, space.Grid(), factory)
+}
+
+func (o *Optimizer) Random(ctx context.Context, space Space, factory Factory, n int, seed int64) ([]Trial, error) {
+	return o.Search(ctx, space.Random(n, seed), factory)
+}
+
+// Search runs trials of all parameter sets in parallel and returns
+// them ranked by the objective, the best first.
+func (o *Optimizer) Search(ctx context.Context, candidates []Params, factory Factory) ([]Trial, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		trials = make([]Trial, len(candidates))
+		jobs   = make(chan int)
+		wg     sync.WaitGroup
+		once   sync.Once
+		ferr   error
+	)
+
+	for w := 0; w < o.opt.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				trial, err := o.Trial(ctx, candidates[i], factory)
+				if err != nil {
+					once.Do(func() {
+						ferr = fmt.Errorf("trial %v: %w", candidates[i], err)
+						cancel()
+					})
+					continue
+				}
+				trials[i] = trial
+			}
+		}()
+	}
+
+loop:
+	for i := range candidates {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	if ferr != nil {
+		return nil, ferr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sortTrials(trials)
+
+	return trials, nil
+}
+
+func (o *Optimizer) Trial(ctx context.Context, params Params, factory Factory) (trial Trial, err error) {
+	provider, err := o.provider()
+	if err != nil {
+		return trial, err
+	}
+
+	result, err := backtest.NewRunner(provider).Execute(ctx, factory(params), o.opt.Backtest)
+	if err != nil {
+		return trial, err
+	}
+
+	return Trial{
+		Params: params,
+		Result: result,
+		Score:  o.opt.Objective(result.Report),
+	}, nil
+}
+
+// provider returns the exchange over the events, it is left
+// to the runner if Options.Exchange is zero.
+func (o *Optimizer) provider() (backtest.Provider, error) {
+	ex := o.opt.Exchange
+
+	if len(ex.Markets) == 0 && len(ex.Wallet) == 0 &&
+		ex.FeeMaker.IsZero() && ex.FeeTaker.IsZero() && ex.FeeBuy.IsZero() && ex.FeeSell.IsZero() {
+		return &public{events: memory(o.events)}, nil
+	}
+
+	if len(ex.Wallet) == 0 {
+		return nil, ErrEmptyWallet
+	}
+
+	return backtest.NewExchange(memory(o.events), ex), nil
+}
+
+// public provides the events only, orders are executed
+// by the exchange simulated by the runner.
+type public struct {
+	backtest.NopProvider
+	events memory
+}
+
+func (p *public) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	return p.events.Subscribe(ctx, symbol)
+}
+
+type memory map[platform.Symbol][]platform.EventContainer
+
+func (m memory) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, 1024)
+
+	go func() {
+		defer close(events)
+
+		for _, e := range m[symbol] {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				select {
+				case events <- platform.MakeError(ctx.Err()):
+				default:
+				}
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+func load(ctx context.Context, public platform.Public, symbol platform.Symbol) ([]platform.EventContainer, error) {
+	var events []platform.EventContainer
+
+	for e := range public.Subscribe(ctx, symbol) {
+		if e.Type == platform.EventErr {
+			return nil, fmt.Errorf("event: %w", e.Error)
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
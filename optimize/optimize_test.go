@@ -0,0 +1,211 @@
+package optimize
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/backtest"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+const (
+	testSymbol platform.Symbol = "BTCUSDT"
+	frame                      = 1000
+	base                       = 100 * frame
+)
+
+// dip buys when the close is not above buy and sells when it is not below sell.
+type dip struct {
+	buy, sell float32
+}
+
+func (dip) Name() string { return "dip" }
+
+func (d dip) BuySignal(snap backtest.HistorySnaphsot) bool {
+	c := snap.Price.Close
+	return len(c) > 0 && c[len(c)-1] <= d.buy
+}
+
+func (d dip) SellSignal(snap backtest.HistorySnaphsot) bool {
+	c := snap.Price.Close
+	return len(c) > 0 && c[len(c)-1] >= d.sell
+}
+
+// swings makes n candles of one frame closed at 100 and 110 in turn.
+func swings(n int) map[platform.Symbol][]platform.EventContainer {
+	events := make([]platform.EventContainer, n)
+	for i := range events {
+		price := fixed.NewI(100, 0)
+		if i%2 == 1 {
+			price = fixed.NewI(110, 0)
+		}
+		events[i] = platform.MakeCandle(platform.Candle{
+			Time:   base + int64(i)*frame,
+			Open:   price,
+			High:   price,
+			Low:    price,
+			Close:  price,
+			Volume: fixed.NewI(1, 0),
+		})
+	}
+	return map[platform.Symbol][]platform.EventContainer{testSymbol: events}
+}
+
+func testOptions() Options {
+	return Options{
+		Backtest: backtest.Options{
+			Symbol:            testSymbol,
+			Account:           1000,
+			FeeBuy:            0.001,
+			FeeSell:           0.001,
+			FramePeriod:       frame,
+			HistoryWindowSize: 4,
+		},
+		Workers: 2,
+	}
+}
+
+func dips(opt backtest.Options) Factory {
+	return Signals(func(params Params) backtest.Strategy {
+		return dip{buy: float32(params.Float("buy")), sell: 110}
+	}, opt)
+}
+
+// space of buy levels, only 100 is reached by the price.
+var space = Space{{Name: "buy", Min: 90, Max: 100, Step: 5}}
+
+func TestGrid(t *testing.T) {
+	opt := testOptions()
+
+	trials, err := NewWithEvents(swings(10), opt).Grid(context.Background(), space, dips(opt.Backtest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trials) != 3 {
+		t.Fatalf("trials = %d, want 3", len(trials))
+	}
+
+	best := trials[0]
+	if best.Params.Float("buy") != 100 {
+		t.Errorf("best buy = %v, want 100", best.Params.Float("buy"))
+	}
+	if best.Score <= 0 || best.Result.Report.RoundTrips != 5 {
+		t.Errorf("best score = %v, round trips = %d, want positive and 5", best.Score, best.Result.Report.RoundTrips)
+	}
+
+	// Levels below the price never trade, ties keep the grid order.
+	for i, want := range []float64{90, 95} {
+		trial := trials[i+1]
+		if trial.Params.Float("buy") != want || trial.Score != 0 || trial.Result.Report.RoundTrips != 0 {
+			t.Errorf("trial %d: buy = %v, score = %v, round trips = %d, want buy %v without trades",
+				i+1, trial.Params.Float("buy"), trial.Score, trial.Result.Report.RoundTrips, want)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	opt := testOptions()
+	o := NewWithEvents(swings(10), opt)
+
+	trials, err := o.Random(context.Background(), space, dips(opt.Backtest), 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trials) != 8 {
+		t.Fatalf("trials = %d, want 8", len(trials))
+	}
+
+	for i, trial := range trials {
+		if i > 0 && trial.Score > trials[i-1].Score {
+			t.Errorf("trial %d score %v is ranked below %v", i, trial.Score, trials[i-1].Score)
+		}
+		if buy := trial.Params.Float("buy"); buy != 90 && buy != 95 && buy != 100 {
+			t.Errorf("trial %d: buy = %v is not on the step", i, buy)
+		}
+		if trades := trial.Params.Float("buy") == 100; trades != (trial.Score > 0) {
+			t.Errorf("trial %d: buy = %v, score = %v", i, trial.Params.Float("buy"), trial.Score)
+		}
+	}
+
+	again, err := o.Random(context.Background(), space, dips(opt.Backtest), 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range trials {
+		if again[i].Params.Float("buy") != trials[i].Params.Float("buy") {
+			t.Fatalf("trials of the same seed differ at %d", i)
+		}
+	}
+}
+
+func TestTrialEmptyWallet(t *testing.T) {
+	opt := testOptions()
+	opt.Exchange = backtest.ExchangeOptions{FeeTaker: fixed.NewS("0.001")}
+
+	_, err := NewWithEvents(swings(4), opt).Trial(context.Background(), Params{"buy": 100}, dips(opt.Backtest))
+	if !errors.Is(err, ErrEmptyWallet) {
+		t.Fatalf("err = %v, want %v", err, ErrEmptyWallet)
+	}
+}
+
+func TestWalkForward(t *testing.T) {
+	opt := testOptions()
+
+	result, err := NewWithEvents(swings(20), opt).WalkForward(context.Background(), space.Grid(), dips(opt.Backtest), WalkForwardOptions{
+		// Lengths are rounded down to frames.
+		InSample:    6*frame + 500,
+		OutOfSample: 4 * frame,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Window{
+		{InStart: base, InEnd: base + 6*frame, OutStart: base + 6*frame, OutEnd: base + 10*frame},
+		{InStart: base + 4*frame, InEnd: base + 10*frame, OutStart: base + 10*frame, OutEnd: base + 14*frame},
+		{InStart: base + 8*frame, InEnd: base + 14*frame, OutStart: base + 14*frame, OutEnd: base + 18*frame},
+		{InStart: base + 12*frame, InEnd: base + 18*frame, OutStart: base + 18*frame, OutEnd: base + 22*frame},
+	}
+
+	if len(result.Windows) != len(want) {
+		t.Fatalf("windows = %d, want %d", len(result.Windows), len(want))
+	}
+
+	var trips int
+
+	for i, w := range result.Windows {
+		if w.InStart != want[i].InStart || w.InEnd != want[i].InEnd || w.OutStart != want[i].OutStart || w.OutEnd != want[i].OutEnd {
+			t.Errorf("window %d = [%d, %d) [%d, %d), want [%d, %d) [%d, %d)", i,
+				w.InStart, w.InEnd, w.OutStart, w.OutEnd,
+				want[i].InStart, want[i].InEnd, want[i].OutStart, want[i].OutEnd)
+		}
+		if buy := w.InSample.Params.Float("buy"); buy != 100 {
+			t.Errorf("window %d: best buy = %v, want 100", i, buy)
+		}
+		if w.OutOfSample.Params.Float("buy") != 100 {
+			t.Errorf("window %d: out-of-sample params = %v", i, w.OutOfSample.Params)
+		}
+
+		// Trades of the out-of-sample window don't leave it.
+		for _, f := range w.OutOfSample.Result.Ledger.Fills {
+			if f.Time < w.OutStart || f.Time >= w.OutEnd {
+				t.Errorf("window %d: fill at %d is out of the window", i, f.Time)
+			}
+		}
+		trips += w.OutOfSample.Result.Report.RoundTrips
+	}
+
+	// Two swings in every window but the last one cut by the history end.
+	if trips != 7 || result.Report.RoundTrips != 7 {
+		t.Errorf("round trips = %d, report = %d, want 7", trips, result.Report.RoundTrips)
+	}
+	if result.Report.Start != base+6*frame || result.Report.End != base+19*frame {
+		t.Errorf("report period = [%d, %d], want [%d, %d]", result.Report.Start, result.Report.End, base+6*frame, base+19*frame)
+	}
+	if result.Report.TotalReturn <= 0 {
+		t.Errorf("total return = %v, want positive", result.Report.TotalReturn)
+	}
+}
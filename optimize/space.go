@@ -0,0 +1,112 @@
+package optimize
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+type Params map[string]float64
+
+func (p Params) Float(name string) float64 {
+	return p[name]
+}
+
+func (p Params) Int(name string) int {
+	return int(math.Round(p[name]))
+}
+
+func (p Params) clone() Params {
+	c := make(Params, len(p))
+	for k, v := range p {
+		c[k] = v
+	}
+	return c
+}
+
+// Param is a range of parameter values from Min to Max inclusive.
+// Values are snapped to the multiples of Step above Min if Step is not zero.
+type Param struct {
+	Name string
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+func (p Param) values() []float64 {
+	if p.Step <= 0 || p.Max <= p.Min {
+		return []float64{p.Min}
+	}
+
+	n := int(math.Floor((p.Max-p.Min)/p.Step+1e-9)) + 1
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = p.Min + float64(i)*p.Step
+	}
+	return values
+}
+
+func (p Param) sample(rnd *rand.Rand) float64 {
+	if p.Max <= p.Min {
+		return p.Min
+	}
+
+	v := p.Min + rnd.Float64()*(p.Max-p.Min)
+	if p.Step > 0 {
+		v = p.Min + math.Round((v-p.Min)/p.Step)*p.Step
+		v = math.Min(v, p.Max)
+	}
+	return v
+}
+
+type Space []Param
+
+// Grid returns all combinations of the parameter values.
+func (s Space) Grid() []Params {
+	var grid = []Params{{}}
+
+	for _, p := range s {
+		values := p.values()
+		next := make([]Params, 0, len(grid)*len(values))
+
+		for _, params := range grid {
+			for _, v := range values {
+				c := params.clone()
+				c[p.Name] = v
+				next = append(next, c)
+			}
+		}
+
+		grid = next
+	}
+
+	return grid
+}
+
+// Random returns n random combinations of the parameter values.
+func (s Space) Random(n int, seed int64) []Params {
+	var (
+		rnd    = rand.New(rand.NewSource(seed))
+		result = make([]Params, n)
+	)
+
+	for i := range result {
+		params := make(Params, len(s))
+		for _, p := range s {
+			params[p.Name] = p.sample(rnd)
+		}
+		result[i] = params
+	}
+
+	return result
+}
+
+func sortTrials(trials []Trial) {
+	sort.SliceStable(trials, func(i, j int) bool {
+		a, b := trials[i].Score, trials[j].Score
+		if math.IsNaN(b) {
+			return !math.IsNaN(a)
+		}
+		return a > b
+	})
+}
@@ -0,0 +1,194 @@
+package optimize
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/WinPooh32/retrade/backtest"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/WinPooh32/series"
+)
+
+// WalkForwardOptions sets lengths of the windows in milliseconds.
+// They are rounded down to multiples of backtest.Options.FramePeriod.
+type WalkForwardOptions struct {
+	InSample    int64
+	OutOfSample int64
+	// Step is a shift between consecutive windows,
+	// OutOfSample is used if it is zero.
+	Step int64
+}
+
+type Window struct {
+	InStart  int64
+	InEnd    int64
+	OutStart int64
+	OutEnd   int64
+
+	// InSample is the best trial of the in-sample optimisation.
+	InSample Trial
+	// OutOfSample is the trial of the best parameters
+	// on the following out-of-sample window.
+	OutOfSample Trial
+}
+
+type WalkForward struct {
+	Windows []Window
+	Equity  series.Data
+	Ledger  *backtest.Ledger
+	Report  backtest.Report
+}
+
+// WalkForward optimises parameters on rolling in-sample windows
+// and evaluates the best ones on the following out-of-sample windows.
+// Out-of-sample equity curves are chained into one, so every window
+// continues with the capital the previous one ended with.
+func (o *Optimizer) WalkForward(ctx context.Context, candidates []Params, factory Factory, wf WalkForwardOptions) (result WalkForward, err error) {
+	var (
+		frame = o.opt.Backtest.FramePeriod
+		is    = wf.InSample / frame * frame
+		oos   = wf.OutOfSample / frame * frame
+		step  = wf.Step / frame * frame
+	)
+
+	if step == 0 {
+		step = oos
+	}
+	if is <= 0 || oos <= 0 {
+		return result, fmt.Errorf("in-sample=%d and out-of-sample=%d must be not less than frame period=%d", wf.InSample, wf.OutOfSample, frame)
+	}
+	var (
+		times       = make(map[platform.Symbol][]int64, len(o.events))
+		first, last int64
+		empty       = true
+	)
+
+	for symbol, events := range o.events {
+		if len(events) == 0 {
+			continue
+		}
+
+		t := eventTimes(events)
+		times[symbol] = t
+
+		if empty || t[0] < first {
+			first = t[0]
+		}
+		if empty || t[len(t)-1] > last {
+			last = t[len(t)-1]
+		}
+		empty = false
+	}
+
+	if empty {
+		return result, fmt.Errorf("no events")
+	}
+
+	first = (first + frame - 1) / frame * frame
+
+	result.Ledger = backtest.NewLedger()
+
+	var (
+		index  []int64
+		equity []float32
+		scale  float32 = 1
+	)
+
+	for start := first; start+is < last; start += step {
+		w := Window{
+			InStart:  start,
+			InEnd:    start + is,
+			OutStart: start + is,
+			OutEnd:   start + is + oos,
+		}
+
+		trials, err := o.window(times, w.InStart, w.InEnd).Search(ctx, candidates, factory)
+		if err != nil {
+			return result, fmt.Errorf("in-sample window start=%d: %w", w.InStart, err)
+		}
+		if len(trials) == 0 {
+			return result, fmt.Errorf("in-sample window start=%d: no trials", w.InStart)
+		}
+		w.InSample = trials[0]
+
+		w.OutOfSample, err = o.window(times, w.OutStart, w.OutEnd).Trial(ctx, w.InSample.Params, factory)
+		if err != nil {
+			return result, fmt.Errorf("out-of-sample window start=%d: %w", w.OutStart, err)
+		}
+
+		result.Windows = append(result.Windows, w)
+
+		// Positions are not carried between windows, so trades are joined as is.
+		ledger := w.OutOfSample.Result.Ledger
+		result.Ledger.Fills = append(result.Ledger.Fills, ledger.Fills...)
+		result.Ledger.RoundTrips = append(result.Ledger.RoundTrips, ledger.RoundTrips...)
+
+		curve := w.OutOfSample.Result.Equity
+		if values := curve.Data(); len(values) > 0 {
+			if len(equity) > 0 && values[0] != 0 {
+				scale = equity[len(equity)-1] / values[0]
+			}
+			for i, v := range values {
+				index = append(index, curve.Index()[i])
+				equity = append(equity, v*scale)
+			}
+		}
+	}
+
+	if len(result.Windows) == 0 {
+		return result, fmt.Errorf("history is shorter than in-sample window")
+	}
+
+	result.Equity = series.MakeData(1, index, equity)
+
+	var (
+		start = result.Windows[0].OutStart
+		end   = result.Windows[len(result.Windows)-1].OutEnd
+	)
+	if end > last {
+		end = last
+	}
+
+	result.Report = backtest.NewReport(result.Ledger, result.Equity, start, end)
+
+	return result, nil
+}
+
+// window makes optimizer of the events between start and end times
+// with preceding history to warm up the strategy.
+func (o *Optimizer) window(times map[platform.Symbol][]int64, start, end int64) *Optimizer {
+	var (
+		bopt   = o.opt.Backtest
+		warmup = start - bopt.HistoryWindowSize*bopt.FramePeriod
+		events = make(map[platform.Symbol][]platform.EventContainer, len(times))
+		opt    = o.opt
+	)
+
+	for symbol, t := range times {
+		l := sort.Search(len(t), func(i int) bool { return t[i] >= warmup })
+		r := sort.Search(len(t), func(i int) bool { return t[i] >= end })
+		events[symbol] = o.events[symbol][l:r]
+	}
+
+	opt.Backtest.Start = start
+
+	return &Optimizer{
+		opt:    opt,
+		events: events,
+	}
+}
+
+func eventTimes(events []platform.EventContainer) []int64 {
+	times := make([]int64, len(events))
+
+	var last int64
+	for i, e := range events {
+		if e.Type != platform.EventErr {
+			last = e.Time()
+		}
+		times[i] = last
+	}
+
+	return times
+}
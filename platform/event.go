@@ -7,6 +7,10 @@ const (
 	EventCandle
 	EventTrade
 	EventBookTicker
+	EventDepth
+	EventReconnect
+	EventOrderUpdate
+	EventBalanceUpdate
 )
 
 type EventContainer struct {
@@ -19,6 +23,10 @@ type Event struct {
 	Trade      Trade
 	Candle     Candle
 	BookTicker BookTicker
+	Depth      Depth
+	Reconnect  Reconnect
+	Order      OrderUpdate
+	Balance    BalanceUpdate
 }
 
 type Trade struct {
@@ -43,6 +51,8 @@ type Candle struct {
 	CountTrades         int64
 	VolumeTakerBuyBase  Fixed
 	VolumeTakerBuyQuote Fixed
+	// Partial marks an update of the candle in progress.
+	Partial bool
 }
 
 type BookTicker struct {
@@ -54,6 +64,95 @@ type BookTicker struct {
 	BestAskQty   Fixed
 }
 
+// PriceLevel is a price level of the order book,
+// zero quantity removes the level.
+type PriceLevel struct {
+	Price    Fixed
+	Quantity Fixed
+}
+
+// Depth is an update of the order book levels. Snapshot replaces
+// the whole book, other updates follow it by the update ids.
+type Depth struct {
+	Time          int64
+	FirstUpdateID int64
+	FinalUpdateID int64
+	Bids          []PriceLevel
+	Asks          []PriceLevel
+	Snapshot      bool
+}
+
+// Reconnect tells that the stream was interrupted between From and To
+// and events of the gap may be missing. Trades of the gap are emitted
+// before the event if they are Backfilled.
+type Reconnect struct {
+	From       int64
+	To         int64
+	Attempts   int
+	Reason     string
+	Backfilled bool
+}
+
+// OrderUpdate is a change of the order state: placement, fill, cancellation, etc.
+// Execution is a kind of the change and Last* fields describe the latest fill.
+type OrderUpdate struct {
+	Time                     int64
+	Symbol                   Symbol
+	OrderID                  string
+	ClientOrderID            string
+	Side                     OrderSide
+	Type                     OrderType
+	Status                   Status
+	Execution                string
+	Price                    Fixed
+	StopPrice                Fixed
+	Quantity                 Fixed
+	ExecutedQuantity         Fixed
+	CummulativeQuoteQuantity Fixed
+	TradeID                  int64
+	LastPrice                Fixed
+	LastQuantity             Fixed
+	Fee                      Fixed
+	FeeAsset                 Symbol
+	IsMaker                  bool
+}
+
+// Balance of the asset, Locked is reserved by open orders.
+type Balance struct {
+	Asset  Symbol
+	Free   Fixed
+	Locked Fixed
+}
+
+// BalanceUpdate holds balances of the assets changed at the time.
+type BalanceUpdate struct {
+	Time     int64
+	Balances []Balance
+}
+
+// Time returns the timestamp of the event in milliseconds.
+// Errors have no timestamp.
+func (e EventContainer) Time() int64 {
+	switch e.Type {
+	case EventCandle:
+		return e.Event.Candle.Time
+	case EventTrade:
+		return e.Event.Trade.Time
+	case EventBookTicker:
+		return e.Event.BookTicker.Time
+	case EventDepth:
+		return e.Event.Depth.Time
+	case EventReconnect:
+		return e.Event.Reconnect.To
+	case EventOrderUpdate:
+		return e.Event.Order.Time
+	case EventBalanceUpdate:
+		return e.Event.Balance.Time
+	default:
+		return 0
+	}
+}
+
 func MakeTrade(t Trade) EventContainer {
 	return EventContainer{
 		Type: EventTrade,
@@ -81,6 +180,42 @@ func MakeBookTicker(b BookTicker) EventContainer {
 	}
 }
 
+func MakeDepth(d Depth) EventContainer {
+	return EventContainer{
+		Type: EventDepth,
+		Event: Event{
+			Depth: d,
+		},
+	}
+}
+
+func MakeReconnect(r Reconnect) EventContainer {
+	return EventContainer{
+		Type: EventReconnect,
+		Event: Event{
+			Reconnect: r,
+		},
+	}
+}
+
+func MakeOrderUpdate(o OrderUpdate) EventContainer {
+	return EventContainer{
+		Type: EventOrderUpdate,
+		Event: Event{
+			Order: o,
+		},
+	}
+}
+
+func MakeBalanceUpdate(b BalanceUpdate) EventContainer {
+	return EventContainer{
+		Type: EventBalanceUpdate,
+		Event: Event{
+			Balance: b,
+		},
+	}
+}
+
 func MakeError(err error) EventContainer {
 	return EventContainer{
 		Type:  EventErr,
@@ -10,14 +10,18 @@ const (
 type OrderType string
 
 const (
-	OrderTypeMarket = "MARKET"
-	OrderTypeLimit  = "LIMIT"
+	OrderTypeMarket        = "MARKET"
+	OrderTypeLimit         = "LIMIT"
+	OrderTypeLimitMaker    = "LIMIT_MAKER"
+	OrderTypeStopLossLimit = "STOP_LOSS_LIMIT"
 )
 
 type Status string
 
 const (
-	StatusFilled = "FILLED"
+	StatusNew      = "NEW"
+	StatusFilled   = "FILLED"
+	StatusCanceled = "CANCELED"
 )
 
 type Order struct {
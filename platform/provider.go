@@ -12,10 +12,11 @@ type Symbol string
 
 type Spot interface {
 	OrderMarket(ctx context.Context, symbol Symbol, side OrderSide, quantity Fixed) (orderID string, err error)
+	OrderLimit(ctx context.Context, symbol Symbol, side OrderSide, price, quantity Fixed) (orderID string, err error)
 	OrderOCO(ctx context.Context, symbol Symbol, side OrderSide, opt OptionsOCO) (orderID string, err error)
 	Cancel(ctx context.Context, symbol Symbol, orderID string) (status string, err error)
 	CancelAll(ctx context.Context, symbol Symbol) (err error)
-	QueryOrder(ctx context.Context) (err error)
+	QueryOrder(ctx context.Context, symbol Symbol, orderID string) (order Order, err error)
 	ListOrders(ctx context.Context, symbol Symbol) (orders []Order, err error)
 }
 
@@ -2,7 +2,9 @@ package binance
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"strconv"
 	"sync"
 	"time"
@@ -14,29 +16,69 @@ import (
 
 var ErrClosed = fmt.Errorf("connection closed")
 
-type control struct {
-	stopC chan struct{}
-	doneC chan struct{}
+type Options struct {
+	// KlinesInterval and KlinesLetter are the interval of the kline stream
+	// to subscribe as they are passed to NewHistory, e.g. 1 and IntervalMinute.
+	// Klines are not streamed if KlinesInterval is zero.
+	KlinesInterval int
+	KlinesLetter   IntervalLetter
+	// Partial streams updates of the klines in progress too.
+	Partial bool
+	// Depth streams the order book snapshot and diff updates.
+	Depth bool
+	// UserData streams order updates of the symbol and balance updates,
+	// it requires the API key.
+	UserData bool
+	// MinBackoff and MaxBackoff bound the delay before reconnection,
+	// 1s and 1m if zero. The delay doubles with every failed attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts of reconnection in a row, unlimited if zero.
+	MaxAttempts int
+	// BaseURL overrides the REST API address, e.g. "https://api.binance.com".
+	BaseURL string
 }
 
 type Binance struct {
-	once sync.Once
+	opt     Options
+	testnet bool
 
-	trades control
-	books  control
+	mu     sync.Mutex
+	conn   *connection
+	closed bool
+	rand   *rand.Rand
+
+	listenKey string
 
 	client *binance.Client
 }
 
+var (
+	_ platform.Public  = (*Binance)(nil)
+	_ platform.Spot    = (*Binance)(nil)
+	_ platform.Account = (*Binance)(nil)
+)
+
 func New(testnet bool, apiKey, secretKey string) (*Binance, error) {
+	return NewWith(testnet, apiKey, secretKey, Options{})
+}
+
+func NewWith(testnet bool, apiKey, secretKey string, opt Options) (*Binance, error) {
 	binance.UseTestnet = testnet
 
 	var b = Binance{
-		client: binance.NewClient(apiKey, secretKey),
+		opt:     opt,
+		testnet: testnet,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		client:  binance.NewClient(apiKey, secretKey),
 	}
 
 	b.client.UserAgent = "retrade/1.0"
 
+	if opt.BaseURL != "" {
+		b.client.BaseURL = opt.BaseURL
+	}
+
 	_, err := b.client.NewSetServerTimeService().Do(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("client: set server time: %w", err)
@@ -45,11 +87,13 @@ func New(testnet bool, apiKey, secretKey string) (*Binance, error) {
 	return &b, nil
 }
 
+// Subscribe streams events of the symbol. Closed streams are reconnected
+// with backoff, EventReconnect is emitted after every reconnection and
+// missed trades are backfilled before it. ErrClosed is emitted when
+// the attempts are exhausted or the provider is closed.
 func (b *Binance) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
 	events := make(chan platform.EventContainer, 1024)
 
-	sink := make(chan platform.EventContainer, 1024)
-
 	go func() {
 		defer func() {
 			var err = b.Close()
@@ -59,83 +103,122 @@ func (b *Binance) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan
 			close(events)
 		}()
 
+		var (
+			connected   bool
+			lastTime    int64
+			lastTradeID int64
+			attempts    int
+			reason      error
+		)
+
+		forward := func(e platform.EventContainer) {
+			if e.Type == platform.EventTrade {
+				// Trades are backfilled up to the reconnection.
+				if e.Event.Trade.TradeID <= lastTradeID {
+					return
+				}
+				lastTradeID = e.Event.Trade.TradeID
+			}
+			if t := e.Time(); t > lastTime {
+				lastTime = t
+			}
+			events <- e
+		}
+
 		for {
-			select {
-			case e := <-sink:
-				events <- e
-			case <-b.books.doneC:
-				events <- platform.MakeError(ErrClosed)
-				return
-			case <-b.trades.doneC:
+			sink := make(chan platform.EventContainer, 1024)
+
+			c, err := b.connect(ctx, symbol, sink)
+			if errors.Is(err, ErrClosed) {
 				events <- platform.MakeError(ErrClosed)
 				return
-			case <-ctx.Done():
-				events <- platform.MakeError(ctx.Err())
-				return
 			}
-		}
-	}()
 
-	errHandler := func(err error) {
-		sink <- platform.MakeError(fmt.Errorf("go-binance: %w", err))
-	}
+			if err == nil {
+				if connected {
+					r := platform.Reconnect{
+						From:     lastTime,
+						To:       b.serverTime(),
+						Attempts: attempts,
+						Reason:   reason.Error(),
+					}
+					if lastTradeID != 0 {
+						id, err := b.backfill(ctx, symbol, lastTradeID+1, r.To, events)
+						lastTradeID = id
+						r.Backfilled = err == nil
+					}
+					events <- platform.MakeReconnect(r)
+				}
+
+				connected, attempts = true, 0
+
+			loop:
+				for {
+					select {
+					case e := <-sink:
+						forward(e)
+					case <-c.doneC:
+						err = c.err
+						break loop
+					case <-ctx.Done():
+						err = ctx.Err()
+						break loop
+					}
+				}
+			}
 
-	wsAggTradeHandler := func(event *binance.WsAggTradeEvent) {
-		t := platform.Trade{
-			TradeID:      event.AggTradeID,
-			Time:         event.TradeTime,
-			Historic:     false,
-			Symbol:       symbol,
-			Price:        fixed.NewS(event.Price),
-			Quantity:     fixed.NewS(event.Quantity),
-			IsBuyerMaker: event.IsBuyerMaker,
-		}
-		sink <- platform.MakeTrade(t)
-	}
+			b.disconnect()
+
+			// Events received before the streams are stopped are not lost.
+		drain:
+			for {
+				select {
+				case e := <-sink:
+					forward(e)
+				default:
+					break drain
+				}
+			}
 
-	wsBookTickerHandler := func(event *binance.WsBookTickerEvent) {
-		b := platform.BookTicker{
-			Time:         time.Now().UnixNano()/int64(time.Millisecond) - b.client.TimeOffset,
-			UpdateID:     strconv.FormatInt(event.UpdateID, 10),
-			BestBidPrice: fixed.NewS(event.BestBidPrice),
-			BestBidQty:   fixed.NewS(event.BestBidQty),
-			BestAskPrice: fixed.NewS(event.BestAskPrice),
-			BestAskQty:   fixed.NewS(event.BestAskQty),
-		}
-		sink <- platform.MakeBookTicker(b)
-	}
+			if ctx.Err() != nil {
+				events <- platform.MakeError(ctx.Err())
+				return
+			}
 
-	var err error
+			if attempts == 0 {
+				reason = err
+			}
+			attempts++
 
-	b.trades.doneC, b.trades.stopC, err = binance.WsAggTradeServe(string(symbol), wsAggTradeHandler, errHandler)
-	if err != nil {
-		sink <- platform.MakeError(fmt.Errorf("go-binance: %w", err))
-		return events
-	}
+			if b.opt.MaxAttempts > 0 && attempts > b.opt.MaxAttempts {
+				events <- platform.MakeError(fmt.Errorf("%w: %s", ErrClosed, reason))
+				return
+			}
 
-	b.books.doneC, b.books.stopC, err = binance.WsBookTickerServe(string(symbol), wsBookTickerHandler, errHandler)
-	if err != nil {
-		sink <- platform.MakeError(fmt.Errorf("go-binance: %w", err))
-		return events
-	}
+			if err := sleep(ctx, b.backoff(attempts)); err != nil {
+				events <- platform.MakeError(err)
+				return
+			}
+		}
+	}()
 
 	return events
 }
 
-func (b *Binance) Wallet(ctx context.Context) (wallet map[string]platform.Fixed, err error) {
+func (b *Binance) Wallet(ctx context.Context) (wallet map[platform.Symbol]platform.Fixed, err error) {
 	res, err := b.client.NewGetAccountService().Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get account: %w", err)
 	}
 
-	wallet = make(map[string]fixed.Fixed, len(res.Balances))
+	wallet = make(map[platform.Symbol]platform.Fixed, len(res.Balances))
 
 	for _, b := range res.Balances {
 		free, err := fixed.Parse(b.Free)
 		if err != nil {
 			return nil, fmt.Errorf("parse value=%s: %w", b.Free, err)
 		}
-		wallet[b.Asset] = free
+		wallet[platform.Symbol(b.Asset)] = free
 	}
 
 	return wallet, nil
@@ -166,6 +249,29 @@ func (b *Binance) OrderMarket(ctx context.Context, symbol platform.Symbol, side
 	return strconv.FormatInt(res.OrderID, 10), nil
 }
 
+func (b *Binance) OrderLimit(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, price, quantity platform.Fixed) (orderID string, err error) {
+	req := b.client.NewCreateOrderService().
+		Symbol(string(symbol)).
+		Type(binance.OrderTypeLimit).
+		TimeInForce(binance.TimeInForceTypeGTC).
+		Price(price.String()).
+		Quantity(quantity.String())
+
+	switch side {
+	case platform.OrderSideBuy:
+		req.Side(binance.SideTypeBuy)
+	case platform.OrderSideSell:
+		req.Side(binance.SideTypeSell)
+	}
+
+	res, err := req.Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("post limit order: %w", err)
+	}
+
+	return strconv.FormatInt(res.OrderID, 10), nil
+}
+
 func (b *Binance) OrderOCO(ctx context.Context, symbol platform.Symbol, side platform.OrderSide, opt platform.OptionsOCO) (orderID string, err error) {
 	req := b.client.NewCreateOCOService().
 		Symbol(string(symbol)).
@@ -219,21 +325,22 @@ func (b *Binance) CancelAll(ctx context.Context, symbol platform.Symbol) (err er
 	return nil
 }
 
-func (b *Binance) QueryOrder(ctx context.Context, symbol platform.Symbol, orderID string) (err error) {
+func (b *Binance) QueryOrder(ctx context.Context, symbol platform.Symbol, orderID string) (order platform.Order, err error) {
 	orderIDInt64, err := strconv.ParseInt(orderID, 10, 64)
 	if err != nil {
-		return fmt.Errorf("parse orderID: parse int: %w", err)
+		return order, fmt.Errorf("parse orderID: parse int: %w", err)
 	}
 
 	req := b.client.NewGetOrderService().
 		Symbol(string(symbol)).
 		OrderID(orderIDInt64)
 
-	_, err = req.Do(ctx)
+	res, err := req.Do(ctx)
 	if err != nil {
-		return fmt.Errorf("query order: %w", err)
+		return order, fmt.Errorf("query order: %w", err)
 	}
-	return nil
+
+	return makeOrder(res), nil
 }
 
 func (b *Binance) ListOrders(ctx context.Context, symbol platform.Symbol) (orders []platform.Order, err error) {
@@ -247,32 +354,39 @@ func (b *Binance) ListOrders(ctx context.Context, symbol platform.Symbol) (order
 
 	orders = make([]platform.Order, 0, len(res))
 	for _, o := range res {
-		orders = append(orders, platform.Order{
-			Symbol:                   o.Symbol,
-			OrderID:                  strconv.FormatInt(o.OrderID, 10),
-			Price:                    o.Price,
-			OrigQuantity:             o.OrigQuantity,
-			ExecutedQuantity:         o.ExecutedQuantity,
-			CummulativeQuoteQuantity: o.CummulativeQuoteQuantity,
-			Status:                   string(o.Status),
-			Type:                     string(o.Type),
-			Side:                     string(o.Side),
-			StopPrice:                o.StopPrice,
-			Time:                     o.Time,
-		})
+		orders = append(orders, makeOrder(o))
 	}
 
 	return orders, nil
 }
 
+func makeOrder(o *binance.Order) platform.Order {
+	return platform.Order{
+		Symbol:                   o.Symbol,
+		OrderID:                  strconv.FormatInt(o.OrderID, 10),
+		Price:                    o.Price,
+		OrigQuantity:             o.OrigQuantity,
+		ExecutedQuantity:         o.ExecutedQuantity,
+		CummulativeQuoteQuantity: o.CummulativeQuoteQuantity,
+		Status:                   string(o.Status),
+		Type:                     string(o.Type),
+		Side:                     string(o.Side),
+		StopPrice:                o.StopPrice,
+		Time:                     o.Time,
+	}
+}
+
 func (b *Binance) Close() error {
-	b.once.Do(func() {
-		close(b.trades.stopC)
-		close(b.books.stopC)
-	})
-	<-b.trades.doneC
-	<-b.books.stopC
-	return nil
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	b.disconnect()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closeUserData()
 }
 
 func init() {
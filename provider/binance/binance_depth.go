@@ -0,0 +1,82 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/book"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+)
+
+const depthSnapshotLimit = 1000
+
+// sequenceDepth emits a snapshot of the order book followed by the diff
+// updates. Stale updates are skipped and the snapshot is fetched again
+// if an update is missed. The connection fails if the snapshot is not fetched.
+func (b *Binance) sequenceDepth(ctx context.Context, c *connection, symbol platform.Symbol, updates <-chan *binance.WsDepthEvent, sink chan<- platform.EventContainer) {
+	bk := book.New()
+
+	for {
+		if !bk.Synced() {
+			d, err := b.depthSnapshot(ctx, symbol)
+			if err != nil {
+				c.fail(fmt.Errorf("depth snapshot: %w", err))
+				return
+			}
+			bk.Apply(d)
+			c.send(sink, platform.MakeDepth(d))
+		}
+
+		select {
+		case event := <-updates:
+			d := platform.Depth{
+				Time:          event.Time,
+				FirstUpdateID: event.FirstUpdateID,
+				FinalUpdateID: event.LastUpdateID,
+				Bids:          makeLevels(event.Bids),
+				Asks:          makeLevels(event.Asks),
+			}
+			if err := bk.Apply(d); err != nil || bk.LastUpdateID() != d.FinalUpdateID {
+				continue
+			}
+			c.send(sink, platform.MakeDepth(d))
+
+		case <-c.doneC:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Binance) depthSnapshot(ctx context.Context, symbol platform.Symbol) (d platform.Depth, err error) {
+	res, err := b.client.NewDepthService().
+		Symbol(string(symbol)).
+		Limit(depthSnapshotLimit).
+		Do(ctx)
+	if err != nil {
+		return d, err
+	}
+
+	return platform.Depth{
+		Time:          b.serverTime(),
+		FinalUpdateID: res.LastUpdateID,
+		Bids:          makeLevels(res.Bids),
+		Asks:          makeLevels(res.Asks),
+		Snapshot:      true,
+	}, nil
+}
+
+func makeLevels(levels []common.PriceLevel) []platform.PriceLevel {
+	result := make([]platform.PriceLevel, len(levels))
+	for i, l := range levels {
+		result[i] = platform.PriceLevel{
+			Price:    fixed.NewS(l.Price),
+			Quantity: fixed.NewS(l.Quantity),
+		}
+	}
+	return result
+}
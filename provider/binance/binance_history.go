@@ -3,11 +3,15 @@ package binance
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 
 	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/history"
 	"github.com/WinPooh32/retrade/platform"
 )
 
@@ -20,112 +24,202 @@ const (
 	IntervalDay    = "d"
 )
 
+const klinesLimit = 1000
+
+type HistoryOptions struct {
+	// Start and End bound open times of the klines in milliseconds,
+	// End is inclusive. Only the latest klines are fetched if Start is zero.
+	Start int64
+	End   int64
+	// Resume is a history file of the subscribed symbol to continue,
+	// klines are fetched after its last record if it exists.
+	Resume string
+	// ResumeReader options of the Resume file in CSV, e.g. its TimeUnit.
+	ResumeReader history.ReaderOptions
+	// WeightLimit of requests per minute, 1200 if zero.
+	WeightLimit int
+	// BaseURL overrides the API host, e.g. "https://api.binance.com".
+	BaseURL string
+}
+
 type BinanceHistory struct {
-	testnet bool
+	rest
 	inteval int
 	letter  IntervalLetter
+	opt     HistoryOptions
 }
 
 func NewHistory(testnet bool, inteval int, letter IntervalLetter) *BinanceHistory {
+	return NewHistoryWith(testnet, inteval, letter, HistoryOptions{})
+}
+
+func NewHistoryWith(testnet bool, inteval int, letter IntervalLetter, opt HistoryOptions) *BinanceHistory {
 	return &BinanceHistory{
-		testnet: testnet,
+		rest:    newRest(testnet, opt.BaseURL, opt.WeightLimit),
 		inteval: inteval,
 		letter:  letter,
+		opt:     opt,
 	}
 }
 
 func (bh *BinanceHistory) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
-	const (
-		Time                = 0
-		Open                = 1
-		High                = 2
-		Low                 = 3
-		Close               = 4
-		Volume              = 5
-		TimeClose           = 6
-		VolumeQuote         = 7
-		CountTrades         = 8
-		VolumeTakerBuyBase  = 9
-		VolumeTakerBuyQuote = 10
-	)
-
 	events := make(chan platform.EventContainer, 32)
 
 	go func() {
 		defer close(events)
 
-		resp, err := http.Get(fmt.Sprintf("%s/v3/klines?symbol=%s&interval=%d%s&limit=10000", bh.api(), symbol, bh.inteval, bh.letter))
+		start, err := bh.start()
 		if err != nil {
-			events <- platform.MakeError(fmt.Errorf("failed to prefetch: %w", err))
+			events <- platform.MakeError(fmt.Errorf("resume: %w", err))
 			return
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			events <- platform.MakeError(fmt.Errorf("unexpected status: %d", resp.StatusCode))
-			return
-		}
-
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			events <- platform.MakeError(fmt.Errorf("read resp body: %w", err))
-			return
-		}
+		for {
+			candles, err := bh.klines(ctx, symbol, start)
+			if err != nil {
+				events <- platform.MakeError(err)
+				return
+			}
 
-		type ohlcv [][]interface{}
-		var vals ohlcv
+			for _, c := range candles {
+				select {
+				case <-ctx.Done():
+					events <- platform.MakeError(ctx.Err())
+					return
+				default:
+				}
 
-		err = json.Unmarshal(data, &vals)
-		if err != nil {
-			events <- platform.MakeError(fmt.Errorf("json unmarshal: %w", err))
-			return
-		}
+				events <- platform.MakeCandle(c)
+			}
 
-		for _, row := range vals {
-			select {
-			case <-ctx.Done():
-				events <- platform.MakeError(ctx.Err())
+			if start == 0 || len(candles) < klinesLimit {
 				return
-			default:
 			}
 
-			tsF64, _ := row[Time].(float64)
-			openStr, _ := row[Open].(string)
-			highStr, _ := row[High].(string)
-			lowStr, _ := row[Low].(string)
-			closeStr, _ := row[Close].(string)
-			volumeStr, _ := row[Volume].(string)
-			tsCloseF64, _ := row[TimeClose].(float64)
-			volumeQuoteStr, _ := row[VolumeQuote].(string)
-			countTradesF64, _ := row[CountTrades].(float64)
-			volumeTakerBuyBaseStr, _ := row[VolumeTakerBuyBase].(string)
-			volumeTakerBuyQuoteStr, _ := row[VolumeTakerBuyQuote].(string)
-
-			c := platform.Candle{
-				Time:                int64(tsF64),
-				Open:                fixed.NewS(openStr),
-				High:                fixed.NewS(highStr),
-				Low:                 fixed.NewS(lowStr),
-				Close:               fixed.NewS(closeStr),
-				Volume:              fixed.NewS(volumeStr),
-				TimeClose:           int64(tsCloseF64),
-				VolumeQuote:         fixed.NewS(volumeQuoteStr),
-				CountTrades:         int64(countTradesF64),
-				VolumeTakerBuyBase:  fixed.NewS(volumeTakerBuyBaseStr),
-				VolumeTakerBuyQuote: fixed.NewS(volumeTakerBuyQuoteStr),
+			start = candles[len(candles)-1].Time + 1
+			if bh.opt.End != 0 && start > bh.opt.End {
+				return
 			}
-
-			events <- platform.MakeCandle(c)
 		}
 	}()
 
 	return events
 }
 
-func (bh *BinanceHistory) api() string {
-	if bh.testnet {
-		return "https://testnet.binance.vision/api"
-	} else {
-		return "https://api.binance.com/api"
+func (bh *BinanceHistory) start() (int64, error) {
+	if bh.opt.Resume == "" {
+		return bh.opt.Start, nil
+	}
+
+	f, err := os.Open(bh.opt.Resume)
+	if errors.Is(err, os.ErrNotExist) {
+		return bh.opt.Start, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	r, err := history.Detect(f, bh.opt.ResumeReader)
+	if err != nil {
+		return 0, fmt.Errorf("history new reader: %w", err)
+	}
+	defer r.Close()
+
+	last, err := history.Last(r)
+	if err == io.EOF {
+		return bh.opt.Start, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read history: %w", err)
+	}
+
+	start := last.Time + IntervalFromLetter(bh.inteval, bh.letter)
+	if start < bh.opt.Start {
+		start = bh.opt.Start
+	}
+
+	return start, nil
+}
+
+// klines fetches a page of klines starting from the open time,
+// the latest ones are fetched if start is zero.
+func (bh *BinanceHistory) klines(ctx context.Context, symbol platform.Symbol, start int64) ([]platform.Candle, error) {
+	query := url.Values{}
+	query.Set("symbol", string(symbol))
+	query.Set("interval", intervalName(bh.inteval, bh.letter))
+	query.Set("limit", strconv.Itoa(klinesLimit))
+	if start != 0 {
+		query.Set("startTime", strconv.FormatInt(start, 10))
+	}
+	if bh.opt.End != 0 {
+		query.Set("endTime", strconv.FormatInt(bh.opt.End, 10))
 	}
+
+	data, err := bh.get(ctx, bh.api()+"/v3/klines?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prefetch: %w", err)
+	}
+
+	return parseKlines(data)
+}
+
+func parseKlines(data []byte) ([]platform.Candle, error) {
+	const (
+		Time                = 0
+		Open                = 1
+		High                = 2
+		Low                 = 3
+		Close               = 4
+		Volume              = 5
+		TimeClose           = 6
+		VolumeQuote         = 7
+		CountTrades         = 8
+		VolumeTakerBuyBase  = 9
+		VolumeTakerBuyQuote = 10
+	)
+
+	type ohlcv [][]interface{}
+	var vals ohlcv
+
+	err := json.Unmarshal(data, &vals)
+	if err != nil {
+		return nil, fmt.Errorf("json unmarshal: %w", err)
+	}
+
+	candles := make([]platform.Candle, 0, len(vals))
+
+	for _, row := range vals {
+		if len(row) <= VolumeTakerBuyQuote {
+			return nil, fmt.Errorf("kline has %d fields", len(row))
+		}
+
+		tsF64, _ := row[Time].(float64)
+		openStr, _ := row[Open].(string)
+		highStr, _ := row[High].(string)
+		lowStr, _ := row[Low].(string)
+		closeStr, _ := row[Close].(string)
+		volumeStr, _ := row[Volume].(string)
+		tsCloseF64, _ := row[TimeClose].(float64)
+		volumeQuoteStr, _ := row[VolumeQuote].(string)
+		countTradesF64, _ := row[CountTrades].(float64)
+		volumeTakerBuyBaseStr, _ := row[VolumeTakerBuyBase].(string)
+		volumeTakerBuyQuoteStr, _ := row[VolumeTakerBuyQuote].(string)
+
+		candles = append(candles, platform.Candle{
+			Time:                int64(tsF64),
+			Open:                fixed.NewS(openStr),
+			High:                fixed.NewS(highStr),
+			Low:                 fixed.NewS(lowStr),
+			Close:               fixed.NewS(closeStr),
+			Volume:              fixed.NewS(volumeStr),
+			TimeClose:           int64(tsCloseF64),
+			VolumeQuote:         fixed.NewS(volumeQuoteStr),
+			CountTrades:         int64(countTradesF64),
+			VolumeTakerBuyBase:  fixed.NewS(volumeTakerBuyBaseStr),
+			VolumeTakerBuyQuote: fixed.NewS(volumeTakerBuyQuoteStr),
+		})
+	}
+
+	return candles, nil
 }
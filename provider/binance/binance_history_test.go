@@ -0,0 +1,107 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/history"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+const minute = int64(60000)
+
+// serveKlines serves minute klines from the start time up to the last one
+// and records requested start times.
+func serveKlines(t *testing.T, last int64, starts *[]int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/klines" {
+			http.NotFound(w, r)
+			return
+		}
+
+		start, _ := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		*starts = append(*starts, start)
+
+		var rows [][]interface{}
+		for open := start; open <= last; open += minute {
+			rows = append(rows, []interface{}{
+				open, "1", "2", "0.5", "1.5", "10",
+				open + minute - 1, "15", 3, "4", "6",
+			})
+		}
+
+		if err := json.NewEncoder(w).Encode(rows); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestHistoryResumeMilliseconds(t *testing.T) {
+	const first = 1600000000000
+
+	name := filepath.Join(t.TempDir(), "history.csv")
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := history.NewWriterWith(f, history.WriterOptions{TimeUnit: history.UnitMilliseconds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts := int64(first); ts < first+3*minute; ts += minute {
+		if err := w.Write(history.OHLCV{Time: ts, Open: fixed.NewI(1, 0), High: fixed.NewI(1, 0), Low: fixed.NewI(1, 0), Close: fixed.NewI(1, 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var starts []int64
+	srv := serveKlines(t, first+5*minute, &starts)
+
+	bh := NewHistoryWith(false, 1, IntervalMinute, HistoryOptions{
+		Resume:       name,
+		ResumeReader: history.ReaderOptions{TimeUnit: history.UnitMilliseconds},
+		BaseURL:      srv.URL,
+	})
+
+	var times []int64
+	for e := range bh.Subscribe(context.Background(), testSymbol) {
+		switch e.Type {
+		case platform.EventErr:
+			t.Fatal(e.Error)
+		case platform.EventCandle:
+			times = append(times, e.Event.Candle.Time)
+		}
+	}
+
+	if len(starts) != 1 || starts[0] != first+3*minute {
+		t.Errorf("requested start times = %v, want [%d]", starts, first+3*minute)
+	}
+
+	want := []int64{first + 3*minute, first + 4*minute, first + 5*minute}
+	if len(times) != len(want) {
+		t.Fatalf("times = %v, want %v", times, want)
+	}
+	for i := range want {
+		if times[i] != want[i] {
+			t.Errorf("times = %v, want %v", times, want)
+			break
+		}
+	}
+}
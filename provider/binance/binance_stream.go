@@ -0,0 +1,274 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/adshao/go-binance/v2"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// Websocket streams are served by these functions,
+// they can be replaced to serve the streams by a local server.
+var (
+	wsAggTradeServe   = binance.WsAggTradeServe
+	wsBookTickerServe = binance.WsBookTickerServe
+	wsKlineServe      = binance.WsKlineServe
+	wsDepthServe      = binance.WsDepthServe100Ms
+)
+
+type control struct {
+	stopC chan struct{}
+	doneC chan struct{}
+}
+
+func (c control) stop() {
+	if c.stopC == nil {
+		return
+	}
+	close(c.stopC)
+	<-c.doneC
+}
+
+// connection is a set of websocket streams of the symbol.
+// It is done when the first of the streams fails.
+type connection struct {
+	trades control
+	books  control
+	klines control
+	depth  control
+	user   control
+
+	once  sync.Once
+	err   error
+	doneC chan struct{}
+	stopC chan struct{}
+}
+
+func newConnection() *connection {
+	return &connection{
+		doneC: make(chan struct{}),
+		stopC: make(chan struct{}),
+	}
+}
+
+func (c *connection) fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.doneC)
+	})
+}
+
+func (c *connection) watch(ctl control) {
+	go func() {
+		<-ctl.doneC
+		c.fail(ErrClosed)
+	}()
+}
+
+func (c *connection) send(sink chan<- platform.EventContainer, e platform.EventContainer) {
+	select {
+	case sink <- e:
+	case <-c.stopC:
+	}
+}
+
+func (c *connection) stop() {
+	close(c.stopC)
+	c.trades.stop()
+	c.books.stop()
+	c.klines.stop()
+	c.depth.stop()
+	c.user.stop()
+	c.fail(ErrClosed)
+}
+
+// connect starts the websocket streams of the symbol, events are sent to the sink.
+func (b *Binance) connect(ctx context.Context, symbol platform.Symbol, sink chan<- platform.EventContainer) (*connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	c := newConnection()
+
+	errHandler := func(err error) {
+		c.fail(fmt.Errorf("go-binance: %w", err))
+	}
+
+	wsAggTradeHandler := func(event *binance.WsAggTradeEvent) {
+		t := platform.Trade{
+			TradeID:      event.AggTradeID,
+			Time:         event.TradeTime,
+			Historic:     false,
+			Symbol:       symbol,
+			Price:        fixed.NewS(event.Price),
+			Quantity:     fixed.NewS(event.Quantity),
+			IsBuyerMaker: event.IsBuyerMaker,
+		}
+		c.send(sink, platform.MakeTrade(t))
+	}
+
+	wsBookTickerHandler := func(event *binance.WsBookTickerEvent) {
+		bt := platform.BookTicker{
+			Time:         b.serverTime(),
+			UpdateID:     strconv.FormatInt(event.UpdateID, 10),
+			BestBidPrice: fixed.NewS(event.BestBidPrice),
+			BestBidQty:   fixed.NewS(event.BestBidQty),
+			BestAskPrice: fixed.NewS(event.BestAskPrice),
+			BestAskQty:   fixed.NewS(event.BestAskQty),
+		}
+		c.send(sink, platform.MakeBookTicker(bt))
+	}
+
+	wsKlineHandler := func(event *binance.WsKlineEvent) {
+		k := event.Kline
+		if !k.IsFinal && !b.opt.Partial {
+			return
+		}
+		candle := platform.Candle{
+			Time:                k.StartTime,
+			Open:                fixed.NewS(k.Open),
+			High:                fixed.NewS(k.High),
+			Low:                 fixed.NewS(k.Low),
+			Close:               fixed.NewS(k.Close),
+			Volume:              fixed.NewS(k.Volume),
+			TimeClose:           k.EndTime,
+			VolumeQuote:         fixed.NewS(k.QuoteVolume),
+			CountTrades:         k.TradeNum,
+			VolumeTakerBuyBase:  fixed.NewS(k.ActiveBuyVolume),
+			VolumeTakerBuyQuote: fixed.NewS(k.ActiveBuyQuoteVolume),
+			Partial:             !k.IsFinal,
+		}
+		c.send(sink, platform.MakeCandle(candle))
+	}
+
+	depthUpdates := make(chan *binance.WsDepthEvent, 1024)
+
+	wsDepthHandler := func(event *binance.WsDepthEvent) {
+		select {
+		case depthUpdates <- event:
+		case <-c.stopC:
+		}
+	}
+
+	var err error
+
+	c.trades.doneC, c.trades.stopC, err = wsAggTradeServe(string(symbol), wsAggTradeHandler, errHandler)
+	if err != nil {
+		c.stop()
+		return nil, fmt.Errorf("go-binance: %w", err)
+	}
+	c.watch(c.trades)
+
+	c.books.doneC, c.books.stopC, err = wsBookTickerServe(string(symbol), wsBookTickerHandler, errHandler)
+	if err != nil {
+		c.stop()
+		return nil, fmt.Errorf("go-binance: %w", err)
+	}
+	c.watch(c.books)
+
+	if b.opt.KlinesInterval != 0 {
+		interval := intervalName(b.opt.KlinesInterval, b.opt.KlinesLetter)
+		c.klines.doneC, c.klines.stopC, err = wsKlineServe(string(symbol), interval, wsKlineHandler, errHandler)
+		if err != nil {
+			c.stop()
+			return nil, fmt.Errorf("go-binance: %w", err)
+		}
+		c.watch(c.klines)
+	}
+
+	if b.opt.Depth {
+		c.depth.doneC, c.depth.stopC, err = wsDepthServe(string(symbol), wsDepthHandler, errHandler)
+		if err != nil {
+			c.stop()
+			return nil, fmt.Errorf("go-binance: %w", err)
+		}
+		c.watch(c.depth)
+		go b.sequenceDepth(ctx, c, symbol, depthUpdates, sink)
+	}
+
+	if b.opt.UserData {
+		err = b.serveUserData(ctx, c, symbol, sink, errHandler)
+		if err != nil {
+			c.stop()
+			return nil, err
+		}
+	}
+
+	b.conn = c
+
+	return c, nil
+}
+
+// disconnect stops the streams of the current connection.
+func (b *Binance) disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn != nil {
+		b.conn.stop()
+		b.conn = nil
+	}
+}
+
+// backfill emits aggregated trades following the trade id up to the end time,
+// it returns id of the last emitted trade.
+func (b *Binance) backfill(ctx context.Context, symbol platform.Symbol, fromID, end int64, events chan<- platform.EventContainer) (lastID int64, err error) {
+	lastID = fromID - 1
+
+	trades := NewAggTrades(b.testnet, AggTradesOptions{
+		FromID:  fromID,
+		End:     end,
+		BaseURL: b.opt.BaseURL,
+	})
+
+	for e := range trades.Subscribe(ctx, symbol) {
+		if e.Type == platform.EventErr {
+			return lastID, e.Error
+		}
+		events <- e
+		lastID = e.Event.Trade.TradeID
+	}
+
+	return lastID, nil
+}
+
+// backoff returns a delay before the reconnection attempt,
+// it grows exponentially and is randomized by the half.
+func (b *Binance) backoff(attempt int) time.Duration {
+	min, max := b.opt.MinBackoff, b.opt.MaxBackoff
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+
+	d := max
+	if attempt < 32 {
+		if v := min << (attempt - 1); v > 0 && v < max {
+			d = v
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return d/2 + time.Duration(b.rand.Int63n(int64(d/2)+1))
+}
+
+func (b *Binance) serverTime() int64 {
+	return time.Now().UnixNano()/int64(time.Millisecond) - b.client.TimeOffset
+}
@@ -0,0 +1,453 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/adshao/go-binance/v2"
+	"nhooyr.io/websocket"
+)
+
+const testSymbol platform.Symbol = "BTCUSDT"
+
+// exchange is a stand-in of the REST API and websocket streams.
+// Accepted aggTrade streams send trades of the sessions in order,
+// all of them but the last one are dropped after that. Trades up to
+// the id are served by the REST API.
+type exchange struct {
+	srv *httptest.Server
+
+	start    int64
+	sessions [][]int64
+	trades   int64
+	refuse   func(dial int) bool
+
+	// keepaliveFails rejects keepalive of listen keys.
+	keepaliveFails bool
+
+	mu         sync.Mutex
+	dials      int
+	accepted   int
+	droppedAt  int64
+	backfills  []url.Values
+	listenKeys int
+	userData   []string
+}
+
+func newExchange(t *testing.T, trades int64, sessions [][]int64, refuse func(dial int) bool) *exchange {
+	ex := &exchange{
+		start:    now() - 10000,
+		sessions: sessions,
+		trades:   trades,
+		refuse:   refuse,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/time", ex.serveTime)
+	mux.HandleFunc("/api/v3/aggTrades", ex.serveAggTrades)
+	mux.HandleFunc("/api/v3/userDataStream", ex.serveUserDataStream)
+	mux.HandleFunc("/ws/", ex.serveStream)
+
+	ex.srv = httptest.NewServer(mux)
+	t.Cleanup(ex.srv.Close)
+
+	// Streams are served by the stand-in instead of go-binance endpoints.
+	aggTradeServe, bookTickerServe, userDataServe := wsAggTradeServe, wsBookTickerServe, wsUserDataServe
+	t.Cleanup(func() {
+		wsAggTradeServe, wsBookTickerServe, wsUserDataServe = aggTradeServe, bookTickerServe, userDataServe
+	})
+
+	wsAggTradeServe = func(symbol string, handler binance.WsAggTradeHandler, errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+		return dial(ex.endpoint(symbol, "aggTrade"), func(message []byte) {
+			event := new(binance.WsAggTradeEvent)
+			if err := json.Unmarshal(message, event); err != nil {
+				errHandler(err)
+				return
+			}
+			handler(event)
+		}, errHandler)
+	}
+	wsBookTickerServe = func(symbol string, handler binance.WsBookTickerHandler, errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+		return dial(ex.endpoint(symbol, "bookTicker"), func([]byte) {}, errHandler)
+	}
+	wsUserDataServe = func(listenKey string, handler binance.WsUserDataHandler, errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+		return dial(fmt.Sprintf("ws%s/ws/%s", strings.TrimPrefix(ex.srv.URL, "http"), listenKey), func([]byte) {}, errHandler)
+	}
+
+	return ex
+}
+
+func (ex *exchange) endpoint(symbol, stream string) string {
+	return fmt.Sprintf("ws%s/ws/%s@%s", strings.TrimPrefix(ex.srv.URL, "http"), strings.ToLower(symbol), stream)
+}
+
+func (ex *exchange) tradeTime(id int64) int64 {
+	return ex.start + id*10
+}
+
+func (ex *exchange) serveTime(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, `{"serverTime":%d}`, now())
+}
+
+func (ex *exchange) serveAggTrades(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	ex.mu.Lock()
+	ex.backfills = append(ex.backfills, query)
+	ex.mu.Unlock()
+
+	fromID, _ := strconv.ParseInt(query.Get("fromId"), 10, 64)
+
+	trades := []aggTrade{}
+	for id := fromID; id <= ex.trades; id++ {
+		trades = append(trades, aggTrade{ID: id, Price: "100", Quantity: "1", Time: ex.tradeTime(id)})
+	}
+
+	json.NewEncoder(w).Encode(trades)
+}
+
+// serveUserDataStream logs requests of listen keys by the method.
+func (ex *exchange) serveUserDataStream(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	listenKey := form.Get("listenKey")
+
+	if r.Method == http.MethodPost {
+		ex.listenKeys++
+		listenKey = fmt.Sprintf("key-%d", ex.listenKeys)
+	}
+
+	ex.userData = append(ex.userData, r.Method+" "+listenKey)
+
+	switch {
+	case r.Method == http.MethodPost:
+		fmt.Fprintf(w, `{"listenKey":%q}`, listenKey)
+	case r.Method == http.MethodPut && ex.keepaliveFails:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code":-1125,"msg":"This listenKey does not exist."}`)
+	default:
+		fmt.Fprint(w, `{}`)
+	}
+}
+
+func (ex *exchange) serveStream(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "@aggTrade") {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		idle(c)
+		return
+	}
+
+	ex.mu.Lock()
+	ex.dials++
+	refused := ex.refuse != nil && ex.refuse(ex.dials)
+	session := ex.accepted
+	if !refused {
+		ex.accepted++
+	}
+	ex.mu.Unlock()
+
+	if refused {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	if session >= len(ex.sessions) {
+		idle(c)
+		return
+	}
+
+	for _, id := range ex.sessions[session] {
+		message, _ := json.Marshal(binance.WsAggTradeEvent{
+			Event:        "aggTrade",
+			Symbol:       string(testSymbol),
+			AggTradeID:   id,
+			Price:        "100",
+			Quantity:     "1",
+			TradeTime:    ex.tradeTime(id),
+			IsBuyerMaker: true,
+		})
+		if err := c.Write(context.Background(), websocket.MessageText, message); err != nil {
+			return
+		}
+	}
+
+	if session == len(ex.sessions)-1 {
+		idle(c)
+		return
+	}
+
+	ex.mu.Lock()
+	ex.droppedAt = now()
+	ex.mu.Unlock()
+
+	c.Close(websocket.StatusGoingAway, "drop")
+}
+
+// idle keeps the stream open until the client closes it.
+func idle(c *websocket.Conn) {
+	for {
+		if _, _, err := c.Read(context.Background()); err != nil {
+			return
+		}
+	}
+}
+
+// dial serves the websocket stream like go-binance does.
+func dial(endpoint string, handler func([]byte), errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c, _, err := websocket.Dial(ctx, endpoint, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	doneC = make(chan struct{})
+	stopC = make(chan struct{})
+
+	go func() {
+		select {
+		case <-stopC:
+		case <-ctx.Done():
+		}
+		c.Close(websocket.StatusNormalClosure, "normal closure")
+	}()
+
+	go func() {
+		defer close(doneC)
+		defer cancel()
+
+		for {
+			_, message, err := c.Read(ctx)
+			if err != nil {
+				select {
+				case <-stopC:
+				default:
+					errHandler(err)
+				}
+				return
+			}
+			handler(message)
+		}
+	}()
+
+	return doneC, stopC, nil
+}
+
+func subscribe(t *testing.T, ex *exchange, opt Options, last int64) (trades []platform.Trade, reconnects []platform.Reconnect, at []int, errs []error) {
+	t.Helper()
+
+	opt.BaseURL = ex.srv.URL
+
+	b, err := NewWith(false, "", "", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for e := range b.Subscribe(ctx, testSymbol) {
+		switch e.Type {
+		case platform.EventTrade:
+			trades = append(trades, e.Event.Trade)
+			if e.Event.Trade.TradeID == last {
+				cancel()
+			}
+		case platform.EventReconnect:
+			reconnects = append(reconnects, e.Event.Reconnect)
+			at = append(at, len(trades))
+		case platform.EventErr:
+			errs = append(errs, e.Error)
+		}
+	}
+
+	return trades, reconnects, at, errs
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	const minBackoff = 40 * time.Millisecond
+
+	// The second dial is refused, trades up to 6 happen before the reconnection.
+	ex := newExchange(t, 6, [][]int64{{1, 2, 3}, {5, 6, 7, 8}}, func(dial int) bool { return dial == 2 })
+
+	trades, reconnects, at, errs := subscribe(t, ex, Options{
+		MinBackoff: minBackoff,
+		MaxBackoff: 4 * minBackoff,
+	}, 8)
+
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("errors = %v, want context canceled", errs)
+	}
+
+	if len(trades) != 8 {
+		t.Fatalf("trades = %d, want 8", len(trades))
+	}
+	for i, trade := range trades {
+		if want := int64(i + 1); trade.TradeID != want {
+			t.Errorf("trade %d id = %d, want %d", i, trade.TradeID, want)
+		}
+		// Missed trades are backfilled, duplicated ones are skipped.
+		if historic := trade.TradeID >= 4 && trade.TradeID <= 6; trade.Historic != historic {
+			t.Errorf("trade id=%d historic = %v, want %v", trade.TradeID, trade.Historic, historic)
+		}
+	}
+
+	if len(reconnects) != 1 {
+		t.Fatalf("reconnects = %d, want 1", len(reconnects))
+	}
+	r := reconnects[0]
+
+	if at[0] != 6 {
+		t.Errorf("reconnect follows %d trades, want 6", at[0])
+	}
+	if r.Attempts != 2 {
+		t.Errorf("attempts = %d, want 2", r.Attempts)
+	}
+	if want := ex.tradeTime(3); r.From != want {
+		t.Errorf("from = %d, want %d", r.From, want)
+	}
+	// Delays of both attempts are at least the half of the backoff.
+	if d := time.Duration(r.To-ex.droppedAt) * time.Millisecond; d < minBackoff*3/2-5*time.Millisecond {
+		t.Errorf("reconnected in %s after the drop, want at least %s", d, minBackoff*3/2)
+	}
+	if !r.Backfilled || r.Reason == "" {
+		t.Errorf("reconnect = %+v, want backfilled with reason", r)
+	}
+
+	if len(ex.backfills) != 1 || ex.backfills[0].Get("fromId") != "4" {
+		t.Errorf("backfill queries = %v, want fromId=4", ex.backfills)
+	}
+	if ex.dials != 3 {
+		t.Errorf("dials = %d, want 3", ex.dials)
+	}
+}
+
+func TestSubscribeMaxAttempts(t *testing.T) {
+	ex := newExchange(t, 3, [][]int64{{1, 2, 3}, {}}, func(dial int) bool { return dial > 1 })
+
+	trades, reconnects, _, errs := subscribe(t, ex, Options{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxAttempts: 2,
+	}, 0)
+
+	if len(trades) != 3 {
+		t.Errorf("trades = %d, want 3", len(trades))
+	}
+	if len(reconnects) != 0 {
+		t.Errorf("reconnects = %d, want 0", len(reconnects))
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrClosed) {
+		t.Errorf("errors = %v, want %v", errs, ErrClosed)
+	}
+	if ex.dials != 3 {
+		t.Errorf("dials = %d, want 3", ex.dials)
+	}
+}
+
+func TestSubscribeReusesListenKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		keepaliveFails bool
+		want           []string
+	}{
+		{
+			"alive",
+			false,
+			[]string{"POST key-1", "PUT key-1", "DELETE key-1"},
+		},
+		{
+			"expired",
+			true,
+			[]string{"POST key-1", "PUT key-1", "DELETE key-1", "POST key-2", "DELETE key-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := newExchange(t, 3, [][]int64{{1, 2, 3}, {4}}, nil)
+			ex.keepaliveFails = tt.keepaliveFails
+
+			trades, reconnects, _, _ := subscribe(t, ex, Options{
+				UserData:   true,
+				MinBackoff: time.Millisecond,
+				MaxBackoff: time.Millisecond,
+			}, 4)
+
+			if len(trades) != 4 || len(reconnects) != 1 {
+				t.Fatalf("trades = %d, reconnects = %d, want 4 and 1", len(trades), len(reconnects))
+			}
+
+			if strings.Join(ex.userData, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("listen key requests = %v, want %v", ex.userData, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeKlinesInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+		want []string
+	}{
+		{"none", Options{}, nil},
+		{"15m", Options{KlinesInterval: 15, KlinesLetter: IntervalMinute}, []string{"15m"}},
+		{"1h", Options{KlinesInterval: 1, KlinesLetter: IntervalHour}, []string{"1h"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := newExchange(t, 3, [][]int64{{1, 2, 3}}, nil)
+
+			klineServe := wsKlineServe
+			t.Cleanup(func() { wsKlineServe = klineServe })
+
+			var (
+				mu        sync.Mutex
+				intervals []string
+			)
+			wsKlineServe = func(symbol, interval string, handler binance.WsKlineHandler, errHandler binance.ErrHandler) (doneC, stopC chan struct{}, err error) {
+				mu.Lock()
+				intervals = append(intervals, interval)
+				mu.Unlock()
+				return dial(ex.endpoint(symbol, "kline_"+interval), func([]byte) {}, errHandler)
+			}
+
+			if trades, _, _, errs := subscribe(t, ex, tt.opt, 3); len(trades) != 3 {
+				t.Fatalf("trades = %d, want 3, errors: %v", len(trades), errs)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.Join(intervals, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("kline intervals = %v, want %v", intervals, tt.want)
+			}
+		})
+	}
+}
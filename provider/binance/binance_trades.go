@@ -0,0 +1,166 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+const (
+	aggTradesLimit = 1000
+	// aggTradesWindow is the longest time range of a request.
+	aggTradesWindow = int64(time.Hour/time.Millisecond) - 1
+)
+
+type AggTradesOptions struct {
+	// Start and End bound times of the trades in milliseconds,
+	// End is inclusive. Only the latest trades are fetched if Start
+	// and FromID are zero.
+	Start int64
+	End   int64
+	// FromID continues from the aggregated trade id instead of Start.
+	FromID int64
+	// WeightLimit of requests per minute, 1200 if zero.
+	WeightLimit int
+	// BaseURL overrides the API host, e.g. "https://api.binance.com".
+	BaseURL string
+}
+
+// BinanceAggTrades fetches historic aggregated trades.
+type BinanceAggTrades struct {
+	rest
+	opt AggTradesOptions
+}
+
+func NewAggTrades(testnet bool, opt AggTradesOptions) *BinanceAggTrades {
+	return &BinanceAggTrades{
+		rest: newRest(testnet, opt.BaseURL, opt.WeightLimit),
+		opt:  opt,
+	}
+}
+
+type aggTrade struct {
+	ID           int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	Time         int64  `json:"T"`
+	IsBuyerMaker bool   `json:"m"`
+}
+
+func (bt *BinanceAggTrades) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, 1024)
+
+	go func() {
+		defer close(events)
+
+		var (
+			fromID = bt.opt.FromID
+			start  = bt.opt.Start
+		)
+
+		for {
+			query := url.Values{}
+			query.Set("symbol", string(symbol))
+			query.Set("limit", strconv.Itoa(aggTradesLimit))
+
+			switch {
+			case fromID != 0:
+				query.Set("fromId", strconv.FormatInt(fromID, 10))
+			case start != 0:
+				// Time range is limited, so the first trade is searched by hours.
+				end := start + aggTradesWindow
+				if bt.opt.End != 0 && end > bt.opt.End {
+					end = bt.opt.End
+				}
+				query.Set("startTime", strconv.FormatInt(start, 10))
+				query.Set("endTime", strconv.FormatInt(end, 10))
+			}
+
+			trades, err := bt.aggTrades(ctx, query)
+			if err != nil {
+				events <- platform.MakeError(err)
+				return
+			}
+
+			if len(trades) == 0 && fromID == 0 && start != 0 {
+				start += aggTradesWindow + 1
+				if (bt.opt.End != 0 && start > bt.opt.End) || start > now() {
+					return
+				}
+				continue
+			}
+
+			for _, t := range trades {
+				if bt.opt.End != 0 && t.Time > bt.opt.End {
+					return
+				}
+
+				select {
+				case events <- platform.MakeTrade(t):
+				case <-ctx.Done():
+					events <- platform.MakeError(ctx.Err())
+					return
+				}
+			}
+
+			// Paging by id is not bounded by time, so a short page is the last one.
+			if (fromID == 0 && start == 0) || (fromID != 0 && len(trades) < aggTradesLimit) {
+				return
+			}
+
+			fromID = trades[len(trades)-1].TradeID + 1
+		}
+	}()
+
+	return events
+}
+
+func (bt *BinanceAggTrades) aggTrades(ctx context.Context, query url.Values) ([]platform.Trade, error) {
+	data, err := bt.get(ctx, bt.api()+"/v3/aggTrades?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch aggregated trades: %w", err)
+	}
+
+	var vals []aggTrade
+
+	err = json.Unmarshal(data, &vals)
+	if err != nil {
+		return nil, fmt.Errorf("json unmarshal: %w", err)
+	}
+
+	symbol := platform.Symbol(query.Get("symbol"))
+	trades := make([]platform.Trade, len(vals))
+
+	for i, v := range vals {
+		price, err := fixed.NewSErr(v.Price)
+		if err != nil {
+			return nil, fmt.Errorf("parse price of trade id=%d: %w", v.ID, err)
+		}
+		qty, err := fixed.NewSErr(v.Quantity)
+		if err != nil {
+			return nil, fmt.Errorf("parse quantity of trade id=%d: %w", v.ID, err)
+		}
+
+		trades[i] = platform.Trade{
+			TradeID:      v.ID,
+			Time:         v.Time,
+			Historic:     true,
+			Symbol:       symbol,
+			Price:        price,
+			Quantity:     qty,
+			IsBuyerMaker: v.IsBuyerMaker,
+		}
+	}
+
+	return trades, nil
+}
+
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
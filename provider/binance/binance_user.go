@@ -0,0 +1,158 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+	"github.com/adshao/go-binance/v2"
+)
+
+// listenKeyKeepalive is a period of the listen key keepalive,
+// the key expires in an hour without it.
+const listenKeyKeepalive = 30 * time.Minute
+
+var wsUserDataServe = binance.WsUserDataServe
+
+// serveUserData starts the user data stream and keeps its listen key alive
+// until the connection is done. The key is reused by reconnections and is
+// closed by Close. Order updates of other symbols are skipped.
+func (b *Binance) serveUserData(ctx context.Context, c *connection, symbol platform.Symbol, sink chan<- platform.EventContainer, errHandler binance.ErrHandler) (err error) {
+	listenKey, err := b.userDataKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	wsUserDataHandler := func(event *binance.WsUserDataEvent) {
+		switch event.Event {
+		case binance.UserDataEventTypeExecutionReport:
+			if event.OrderUpdate.Symbol != string(symbol) {
+				return
+			}
+			c.send(sink, platform.MakeOrderUpdate(makeOrderUpdate(event.OrderUpdate)))
+
+		case binance.UserDataEventTypeOutboundAccountPosition:
+			c.send(sink, platform.MakeBalanceUpdate(makeBalanceUpdate(event)))
+		}
+	}
+
+	c.user.doneC, c.user.stopC, err = wsUserDataServe(listenKey, wsUserDataHandler, errHandler)
+	if err != nil {
+		return fmt.Errorf("go-binance: %w", err)
+	}
+	c.watch(c.user)
+
+	go b.keepalive(ctx, c, listenKey)
+
+	return nil
+}
+
+// userDataKey returns the listen key of the previous connection if it is
+// still alive, a new key is started otherwise.
+func (b *Binance) userDataKey(ctx context.Context) (string, error) {
+	if b.listenKey != "" {
+		err := b.client.NewKeepaliveUserStreamService().ListenKey(b.listenKey).Do(ctx)
+		if err == nil {
+			return b.listenKey, nil
+		}
+		// The key is likely expired, it is closed anyway not to be left open.
+		b.client.NewCloseUserStreamService().ListenKey(b.listenKey).Do(ctx)
+		b.listenKey = ""
+	}
+
+	listenKey, err := b.client.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("start user stream: %w", err)
+	}
+
+	b.listenKey = listenKey
+	return listenKey, nil
+}
+
+func (b *Binance) keepalive(ctx context.Context, c *connection, listenKey string) {
+	t := time.NewTicker(listenKeyKeepalive)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			err := b.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx)
+			if err != nil {
+				c.fail(fmt.Errorf("keepalive user stream: %w", err))
+				return
+			}
+		case <-c.doneC:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// closeUserData invalidates the listen key of the user data stream.
+func (b *Binance) closeUserData() error {
+	if b.listenKey == "" {
+		return nil
+	}
+
+	err := b.client.NewCloseUserStreamService().ListenKey(b.listenKey).Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("close user stream: %w", err)
+	}
+
+	b.listenKey = ""
+	return nil
+}
+
+func makeOrderUpdate(o binance.WsOrderUpdate) platform.OrderUpdate {
+	side := platform.OrderSide(platform.OrderSideSell)
+	if o.Side == string(binance.SideTypeBuy) {
+		side = platform.OrderSideBuy
+	}
+
+	return platform.OrderUpdate{
+		Time:                     o.TransactionTime,
+		Symbol:                   platform.Symbol(o.Symbol),
+		OrderID:                  strconv.FormatInt(o.Id, 10),
+		ClientOrderID:            o.ClientOrderId,
+		Side:                     side,
+		Type:                     platform.OrderType(o.Type),
+		Status:                   platform.Status(o.Status),
+		Execution:                o.ExecutionType,
+		Price:                    fixed.NewS(o.Price),
+		StopPrice:                fixed.NewS(o.StopPrice),
+		Quantity:                 fixed.NewS(o.Volume),
+		ExecutedQuantity:         fixed.NewS(o.FilledVolume),
+		CummulativeQuoteQuantity: fixed.NewS(o.FilledQuoteVolume),
+		TradeID:                  o.TradeId,
+		LastPrice:                fixed.NewS(o.LatestPrice),
+		LastQuantity:             fixed.NewS(o.LatestVolume),
+		Fee:                      fixed.NewS(o.FeeCost),
+		FeeAsset:                 platform.Symbol(o.FeeAsset),
+		IsMaker:                  o.IsMaker,
+	}
+}
+
+func makeBalanceUpdate(event *binance.WsUserDataEvent) platform.BalanceUpdate {
+	balances := make([]platform.Balance, len(event.AccountUpdate))
+	for i, a := range event.AccountUpdate {
+		balances[i] = platform.Balance{
+			Asset:  platform.Symbol(a.Asset),
+			Free:   fixed.NewS(a.Free),
+			Locked: fixed.NewS(a.Locked),
+		}
+	}
+
+	t := event.AccountUpdateTime
+	if t == 0 {
+		t = event.Time
+	}
+
+	return platform.BalanceUpdate{
+		Time:     t,
+		Balances: balances,
+	}
+}
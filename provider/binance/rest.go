@@ -0,0 +1,103 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// weightLimit is the default request weight limit per minute.
+const weightLimit = 1200
+
+// rest is a client of the public REST API.
+type rest struct {
+	testnet     bool
+	baseURL     string
+	weightLimit int
+}
+
+func newRest(testnet bool, baseURL string, limit int) rest {
+	if limit <= 0 {
+		limit = weightLimit
+	}
+	return rest{
+		testnet:     testnet,
+		baseURL:     baseURL,
+		weightLimit: limit,
+	}
+}
+
+// get requests the API respecting the request weight limit,
+// it waits and retries if the limit is exceeded.
+func (r rest) get(ctx context.Context, addr string) ([]byte, error) {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("new request: %w", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read resp body: %w", err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if used, _ := strconv.Atoi(resp.Header.Get("X-Mbx-Used-Weight-1m")); used >= r.weightLimit*9/10 {
+				if err := sleep(ctx, untilNextMinute()); err != nil {
+					return nil, err
+				}
+			}
+			return data, nil
+
+		case http.StatusTooManyRequests, http.StatusTeapot:
+			wait := untilNextMinute()
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(s) * time.Second
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+		}
+	}
+}
+
+func (r rest) api() string {
+	if r.baseURL != "" {
+		return r.baseURL + "/api"
+	}
+	if r.testnet {
+		return "https://testnet.binance.vision/api"
+	} else {
+		return "https://api.binance.com/api"
+	}
+}
+
+func untilNextMinute() time.Duration {
+	now := time.Now()
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -24,3 +24,8 @@ func IntervalFromLetter(period int, letter IntervalLetter) (interval int64) {
 	}
 	return int64(period) * scale
 }
+
+// intervalName returns the interval as the API names it, e.g. "1m".
+func intervalName(period int, letter IntervalLetter) string {
+	return fmt.Sprintf("%d%s", period, letter)
+}
@@ -2,22 +2,51 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 
-	"github.com/WinPooh32/fixed"
 	"github.com/WinPooh32/retrade/history"
 	"github.com/WinPooh32/retrade/platform"
 )
 
-type File struct{ file *os.File }
+// Kind is a kind of records stored in the file.
+type Kind int
+
+const (
+	Candles Kind = iota
+	Trades
+	BookTickers
+)
+
+type Options struct {
+	Kind Kind
+	// Reader sets up parsing of CSV candles.
+	Reader history.ReaderOptions
+	// Start and End bound times of the emitted events in milliseconds,
+	// End is exclusive. Zero value does not bound. Records must be sorted by time,
+	// uncompressed binary and CSV candles are searched, compressed files,
+	// trades and book tickers are scanned.
+	Start int64
+	End   int64
+}
+
+type File struct {
+	file *os.File
+	opt  Options
+}
 
 func Open(name string) (f File, err error) {
+	return OpenWith(name, Options{})
+}
+
+func OpenWith(name string, opt Options) (f File, err error) {
 	f.file, err = os.OpenFile(name, os.O_CREATE|os.O_RDONLY, 0666)
 	if err != nil {
 		return f, fmt.Errorf("failed to open: %w", err)
 	}
+	f.opt = opt
 	return f, nil
 }
 
@@ -28,16 +57,18 @@ func (f File) Close() error {
 func (f File) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
 	events := make(chan platform.EventContainer, 1024)
 
-	r, err := history.NewReader(f.file)
+	read, closer, err := f.reader(symbol)
 	if err != nil {
-		events <- platform.MakeError(fmt.Errorf("history new reader: %w", err))
-		return nil
+		events <- platform.MakeError(err)
+		close(events)
+		return events
 	}
 
 	go func() {
 		defer close(events)
+		defer closer.Close()
 
-		for i := 0; ; i++ {
+		for {
 			select {
 			case <-ctx.Done():
 				events <- platform.MakeError(ctx.Err())
@@ -45,32 +76,137 @@ func (f File) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan plat
 			default:
 			}
 
-			t, err := r.Read()
+			e, err := read()
 			if err == io.EOF {
 				return
 			}
 			if err != nil {
-				events <- platform.MakeError(fmt.Errorf("read slow candles: %w", err))
+				events <- platform.MakeError(err)
+				return
+			}
+			if t := e.Time(); t < f.opt.Start {
+				continue
+			} else if f.opt.End != 0 && t >= f.opt.End {
 				return
 			}
-			c := platform.MakeCandle(
-				platform.Candle{
-					Time:                t.Time * 1000,
-					Open:                t.Open,
-					High:                t.High,
-					Low:                 t.Low,
-					Close:               t.Close,
-					Volume:              t.Volume,
-					TimeClose:           0,
-					VolumeQuote:         fixed.ZERO,
-					CountTrades:         0,
-					VolumeTakerBuyBase:  fixed.ZERO,
-					VolumeTakerBuyQuote: fixed.ZERO,
-				},
-			)
-			events <- c
+			events <- e
 		}
 	}()
 
 	return events
 }
+
+func (f File) reader(symbol platform.Symbol) (func() (platform.EventContainer, error), io.Closer, error) {
+	switch f.opt.Kind {
+	case Candles:
+		return f.candles(symbol)
+	case Trades:
+		return f.trades(symbol)
+	case BookTickers:
+		return f.bookTickers()
+	default:
+		return nil, nil, fmt.Errorf("unknown kind=%d", f.opt.Kind)
+	}
+}
+
+func (f File) candles(symbol platform.Symbol) (func() (platform.EventContainer, error), io.Closer, error) {
+	r, err := history.Detect(f.file, f.opt.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("history new reader: %w", err)
+	}
+
+	if br, ok := r.(*history.BinaryReader); ok {
+		if s := br.Header().Symbol; s != "" && s != string(symbol) {
+			r.Close()
+			return nil, nil, fmt.Errorf("history of symbol=%s is opened for symbol=%s", s, symbol)
+		}
+	}
+
+	if s, ok := r.(interface{ SeekTime(int64) error }); ok && f.opt.Start != 0 {
+		err := s.SeekTime(f.opt.Start)
+		if err != nil && !errors.Is(err, history.ErrNotSeekable) {
+			r.Close()
+			return nil, nil, fmt.Errorf("seek start=%d: %w", f.opt.Start, err)
+		}
+	}
+
+	return func() (platform.EventContainer, error) {
+		t, err := r.Read()
+		if err == io.EOF {
+			return platform.EventContainer{}, err
+		}
+		if err != nil {
+			return platform.EventContainer{}, fmt.Errorf("read slow candles: %w", err)
+		}
+		return platform.MakeCandle(
+			platform.Candle{
+				Time:                t.Time,
+				Open:                t.Open,
+				High:                t.High,
+				Low:                 t.Low,
+				Close:               t.Close,
+				Volume:              t.Volume,
+				TimeClose:           t.TimeClose,
+				VolumeQuote:         t.VolumeQuote,
+				CountTrades:         t.CountTrades,
+				VolumeTakerBuyBase:  t.VolumeTakerBuyBase,
+				VolumeTakerBuyQuote: t.VolumeTakerBuyQuote,
+			},
+		), nil
+	}, r, nil
+}
+
+func (f File) trades(symbol platform.Symbol) (func() (platform.EventContainer, error), io.Closer, error) {
+	r, err := history.NewTradeReader(f.file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("history new trade reader: %w", err)
+	}
+
+	return func() (platform.EventContainer, error) {
+		t, err := r.ReadTrade()
+		if err == io.EOF {
+			return platform.EventContainer{}, err
+		}
+		if err != nil {
+			return platform.EventContainer{}, fmt.Errorf("read trades: %w", err)
+		}
+		return platform.MakeTrade(
+			platform.Trade{
+				TradeID:      t.TradeID,
+				Time:         t.Time,
+				Historic:     true,
+				Symbol:       symbol,
+				Price:        t.Price,
+				Quantity:     t.Quantity,
+				IsBuyerMaker: t.IsBuyerMaker,
+			},
+		), nil
+	}, r, nil
+}
+
+func (f File) bookTickers() (func() (platform.EventContainer, error), io.Closer, error) {
+	r, err := history.NewBookTickerReader(f.file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("history new book ticker reader: %w", err)
+	}
+
+	return func() (platform.EventContainer, error) {
+		b, err := r.ReadBookTicker()
+		if err == io.EOF {
+			return platform.EventContainer{}, err
+		}
+		if err != nil {
+			return platform.EventContainer{}, fmt.Errorf("read book tickers: %w", err)
+		}
+		return platform.MakeBookTicker(
+			platform.BookTicker{
+				Time:         b.Time,
+				UpdateID:     b.UpdateID,
+				BestBidPrice: b.BestBidPrice,
+				BestBidQty:   b.BestBidQty,
+				BestAskPrice: b.BestAskPrice,
+				BestAskQty:   b.BestAskQty,
+			},
+		), nil
+	}, r, nil
+}
@@ -0,0 +1,185 @@
+package merge
+
+import (
+	"context"
+
+	"github.com/WinPooh32/retrade/platform"
+)
+
+// Provider combines event streams of several providers into one.
+//
+// Overlapping events are dropped: candles not newer than the last emitted
+// closed candle, trades with not greater trade ID or older than the last
+// emitted trade and book tickers older than the last emitted book ticker.
+// Errors are passed through as is.
+type Provider struct {
+	providers []platform.Public
+	concat    bool
+}
+
+var _ platform.Public = &Provider{}
+
+// Concat streams providers one after another. Every next provider is
+// subscribed when the previous one is exhausted, so history providers
+// can be followed by a live one.
+func Concat(providers ...platform.Public) *Provider {
+	return &Provider{
+		providers: providers,
+		concat:    true,
+	}
+}
+
+// Merge subscribes all providers at once and interleaves their events
+// in time order. Events with equal timestamps are ordered as candles,
+// trades and then book tickers, and by order of the providers after that.
+func Merge(providers ...platform.Public) *Provider {
+	return &Provider{
+		providers: providers,
+		concat:    false,
+	}
+}
+
+func (p *Provider) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, 1024)
+
+	go func() {
+		defer close(events)
+
+		var d dedup
+
+		emit := func(e platform.EventContainer) bool {
+			if !d.accept(e) {
+				return true
+			}
+			select {
+			case events <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if p.concat {
+			p.runConcat(ctx, symbol, emit)
+		} else {
+			p.runMerge(ctx, symbol, emit)
+		}
+	}()
+
+	return events
+}
+
+func (p *Provider) runConcat(ctx context.Context, symbol platform.Symbol, emit func(platform.EventContainer) bool) {
+	for _, provider := range p.providers {
+		for e := range provider.Subscribe(ctx, symbol) {
+			if !emit(e) {
+				return
+			}
+		}
+	}
+}
+
+type head struct {
+	events <-chan platform.EventContainer
+	event  platform.EventContainer
+	ok     bool
+}
+
+func (p *Provider) runMerge(ctx context.Context, symbol platform.Symbol, emit func(platform.EventContainer) bool) {
+	heads := make([]head, len(p.providers))
+
+	for i, provider := range p.providers {
+		h := &heads[i]
+		h.events = provider.Subscribe(ctx, symbol)
+		h.event, h.ok = <-h.events
+	}
+
+	for {
+		var next *head
+
+		for i := range heads {
+			h := &heads[i]
+			if !h.ok {
+				continue
+			}
+			if h.event.Type == platform.EventErr {
+				next = h
+				break
+			}
+			if next == nil || before(h.event, next.event) {
+				next = h
+			}
+		}
+
+		if next == nil {
+			return
+		}
+
+		if !emit(next.event) {
+			return
+		}
+
+		next.event, next.ok = <-next.events
+	}
+}
+
+func before(a, b platform.EventContainer) bool {
+	ta, tb := a.Time(), b.Time()
+	if ta != tb {
+		return ta < tb
+	}
+	return priority(a.Type) < priority(b.Type)
+}
+
+func priority(t platform.EventType) int {
+	switch t {
+	case platform.EventCandle:
+		return 0
+	case platform.EventTrade:
+		return 1
+	case platform.EventBookTicker:
+		return 2
+	default:
+		return 3
+	}
+}
+
+type dedup struct {
+	candle  int64
+	trade   int64
+	tradeID int64
+	book    int64
+
+	seenCandle bool
+	seenTrade  bool
+	seenBook   bool
+}
+
+func (d *dedup) accept(e platform.EventContainer) bool {
+	switch e.Type {
+	case platform.EventCandle:
+		c := e.Event.Candle
+		if d.seenCandle && c.Time <= d.candle {
+			return false
+		}
+		if !c.Partial {
+			d.candle, d.seenCandle = c.Time, true
+		}
+
+	case platform.EventTrade:
+		t := e.Event.Trade
+		if d.seenTrade && (t.Time < d.trade || t.TradeID != 0 && t.TradeID <= d.tradeID) {
+			return false
+		}
+		d.trade, d.tradeID, d.seenTrade = t.Time, t.TradeID, true
+
+	case platform.EventBookTicker:
+		b := e.Event.BookTicker
+		if d.seenBook && b.Time < d.book {
+			return false
+		}
+		d.book, d.seenBook = b.Time, true
+	}
+
+	return true
+}
@@ -0,0 +1,214 @@
+package merge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WinPooh32/retrade/platform"
+)
+
+// stream serves the events of the subscribed symbol and closes.
+type stream map[platform.Symbol][]platform.EventContainer
+
+func (s stream) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, len(s[symbol]))
+	for _, e := range s[symbol] {
+		events <- e
+	}
+	close(events)
+	return events
+}
+
+// endless serves the events and stays open until the context is done.
+type endless []platform.EventContainer
+
+func (s endless) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer)
+	go func() {
+		defer close(events)
+		for _, e := range s {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return events
+}
+
+func candle(t int64) platform.EventContainer {
+	return platform.MakeCandle(platform.Candle{Time: t})
+}
+
+func trade(t, id int64) platform.EventContainer {
+	return platform.MakeTrade(platform.Trade{Time: t, TradeID: id})
+}
+
+func book(t int64, id string) platform.EventContainer {
+	return platform.MakeBookTicker(platform.BookTicker{Time: t, UpdateID: id})
+}
+
+func describe(e platform.EventContainer) string {
+	switch e.Type {
+	case platform.EventCandle:
+		return fmt.Sprintf("c%d", e.Event.Candle.Time)
+	case platform.EventTrade:
+		return fmt.Sprintf("t%d#%d", e.Event.Trade.Time, e.Event.Trade.TradeID)
+	case platform.EventBookTicker:
+		return fmt.Sprintf("b%d/%s", e.Event.BookTicker.Time, e.Event.BookTicker.UpdateID)
+	case platform.EventErr:
+		return "err"
+	default:
+		return "?"
+	}
+}
+
+// collect reads all events of the symbol and fails if the stream is not closed in time.
+func collect(t *testing.T, p platform.Public, symbol platform.Symbol) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []string
+	for e := range p.Subscribe(ctx, symbol) {
+		got = append(got, describe(e))
+	}
+	if ctx.Err() != nil {
+		t.Fatal("stream is not closed")
+	}
+	return strings.Join(got, " ")
+}
+
+func TestMergeOrder(t *testing.T) {
+	p := Merge(
+		stream{
+			"BTCUSDT": {candle(10), candle(30), candle(50)},
+			"ETHUSDT": {trade(15, 1), trade(25, 2)},
+		},
+		stream{
+			"BTCUSDT": {candle(20), candle(40)},
+			"ETHUSDT": {trade(5, 3), trade(35, 4)},
+		},
+	)
+
+	tests := []struct {
+		symbol platform.Symbol
+		want   string
+	}{
+		{"BTCUSDT", "c10 c20 c30 c40 c50"},
+		// Events are ordered by time, the trade with the lower ID is dropped
+		// as an overlap after the later one.
+		{"ETHUSDT", "t5#3 t35#4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.symbol), func(t *testing.T) {
+			if got := collect(t, p, tt.symbol); got != tt.want {
+				t.Errorf("events = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTie(t *testing.T) {
+	p := Merge(
+		stream{"BTCUSDT": {trade(10, 1), book(10, "a"), book(20, "a")}},
+		stream{"BTCUSDT": {candle(10), trade(10, 2), book(10, "b"), book(20, "b")}},
+	)
+
+	// Candles go before trades and book tickers at the same time,
+	// events of the same type keep the order of the providers.
+	want := "c10 t10#1 t10#2 b10/a b10/b b20/a b20/b"
+	if got := collect(t, p, "BTCUSDT"); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+func TestMergeEnds(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []platform.Public
+		want      string
+	}{
+		{
+			"early end",
+			[]platform.Public{
+				stream{"BTCUSDT": {candle(10)}},
+				stream{"BTCUSDT": {candle(20), candle(30), candle(40)}},
+			},
+			"c10 c20 c30 c40",
+		},
+		{
+			"error",
+			[]platform.Public{
+				stream{"BTCUSDT": {candle(10), candle(30), platform.MakeError(errors.New("failed"))}},
+				stream{"BTCUSDT": {candle(20), candle(40), candle(50)}},
+			},
+			"c10 c20 c30 err c40 c50",
+		},
+		{
+			"empty",
+			[]platform.Public{stream{}, stream{}},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collect(t, Merge(tt.providers...), "BTCUSDT"); got != tt.want {
+				t.Errorf("events = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := Merge(
+		stream{"BTCUSDT": {candle(10)}},
+		endless{candle(20)},
+	)
+
+	events := p.Subscribe(ctx, "BTCUSDT")
+
+	var got []string
+	for _, want := range []string{"c10", "c20"} {
+		e := <-events
+		if describe(e) != want {
+			t.Fatalf("event = %s, want %s", describe(e), want)
+		}
+		got = append(got, want)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stream is not closed after %v", got)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	p := Concat(
+		stream{"BTCUSDT": {candle(10), candle(20), candle(30)}},
+		stream{"BTCUSDT": {candle(20), candle(30), candle(40)}},
+	)
+
+	// Overlapping candles of the next provider are dropped.
+	want := "c10 c20 c30 c40"
+	if got := collect(t, p, "BTCUSDT"); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/WinPooh32/retrade/platform"
+)
+
+// ErrRecorded wraps errors read from a record.
+var ErrRecorded = fmt.Errorf("recorded error")
+
+const (
+	typeError      = "error"
+	typeCandle     = "candle"
+	typeTrade      = "trade"
+	typeBookTicker = "bookticker"
+	typeDepth      = "depth"
+	typeReconnect  = "reconnect"
+	typeOrder      = "order"
+	typeBalance    = "balance"
+)
+
+// line is a single recorded event, records are stored as JSON lines.
+type line struct {
+	Symbol     platform.Symbol         `json:"symbol"`
+	Type       string                  `json:"type"`
+	Error      string                  `json:"error,omitempty"`
+	Candle     *platform.Candle        `json:"candle,omitempty"`
+	Trade      *platform.Trade         `json:"trade,omitempty"`
+	BookTicker *platform.BookTicker    `json:"bookTicker,omitempty"`
+	Depth      *platform.Depth         `json:"depth,omitempty"`
+	Reconnect  *platform.Reconnect     `json:"reconnect,omitempty"`
+	Order      *platform.OrderUpdate   `json:"order,omitempty"`
+	Balance    *platform.BalanceUpdate `json:"balance,omitempty"`
+}
+
+func makeLine(symbol platform.Symbol, e platform.EventContainer) line {
+	l := line{Symbol: symbol}
+
+	switch e.Type {
+	case platform.EventErr:
+		l.Type = typeError
+		if e.Error != nil {
+			l.Error = e.Error.Error()
+		}
+	case platform.EventCandle:
+		l.Type = typeCandle
+		l.Candle = &e.Event.Candle
+	case platform.EventTrade:
+		l.Type = typeTrade
+		l.Trade = &e.Event.Trade
+	case platform.EventBookTicker:
+		l.Type = typeBookTicker
+		l.BookTicker = &e.Event.BookTicker
+	case platform.EventDepth:
+		l.Type = typeDepth
+		l.Depth = &e.Event.Depth
+	case platform.EventReconnect:
+		l.Type = typeReconnect
+		l.Reconnect = &e.Event.Reconnect
+	case platform.EventOrderUpdate:
+		l.Type = typeOrder
+		l.Order = &e.Event.Order
+	case platform.EventBalanceUpdate:
+		l.Type = typeBalance
+		l.Balance = &e.Event.Balance
+	}
+
+	return l
+}
+
+func (l line) event() (platform.EventContainer, error) {
+	switch {
+	case l.Type == typeError:
+		return platform.MakeError(fmt.Errorf("%w: %s", ErrRecorded, l.Error)), nil
+	case l.Type == typeCandle && l.Candle != nil:
+		return platform.MakeCandle(*l.Candle), nil
+	case l.Type == typeTrade && l.Trade != nil:
+		return platform.MakeTrade(*l.Trade), nil
+	case l.Type == typeBookTicker && l.BookTicker != nil:
+		return platform.MakeBookTicker(*l.BookTicker), nil
+	case l.Type == typeDepth && l.Depth != nil:
+		return platform.MakeDepth(*l.Depth), nil
+	case l.Type == typeReconnect && l.Reconnect != nil:
+		return platform.MakeReconnect(*l.Reconnect), nil
+	case l.Type == typeOrder && l.Order != nil:
+		return platform.MakeOrderUpdate(*l.Order), nil
+	case l.Type == typeBalance && l.Balance != nil:
+		return platform.MakeBalanceUpdate(*l.Balance), nil
+	default:
+		return platform.EventContainer{}, fmt.Errorf("unknown event type=%q", l.Type)
+	}
+}
+
+// Recorder writes all events passing through the wrapped provider.
+// Subscriptions of different symbols share the same writer.
+type Recorder struct {
+	public platform.Public
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+var _ platform.Public = &Recorder{}
+
+func NewRecorder(public platform.Public, w io.Writer) *Recorder {
+	return &Recorder{
+		public: public,
+		enc:    json.NewEncoder(w),
+	}
+}
+
+func (r *Recorder) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, 1024)
+
+	go func() {
+		defer close(events)
+
+		var recording = true
+
+		for e := range r.public.Subscribe(ctx, symbol) {
+			// Cancellation is not a part of the session.
+			if recording && !(e.Type == platform.EventErr && ctx.Err() != nil) {
+				if err := r.write(symbol, e); err != nil {
+					recording = false
+					events <- platform.MakeError(fmt.Errorf("record: %w", err))
+				}
+			}
+			events <- e
+		}
+	}()
+
+	return events
+}
+
+func (r *Recorder) write(symbol platform.Symbol, e platform.EventContainer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(makeLine(symbol, e))
+}
+
+// Replay reads events recorded by Recorder and emits them as they were
+// with their original timestamps. Recorded errors are wrapped by ErrRecorded.
+type Replay struct{ name string }
+
+var _ platform.Public = Replay{}
+
+func NewReplay(name string) Replay {
+	return Replay{name: name}
+}
+
+func (r Replay) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, 1024)
+
+	go func() {
+		defer close(events)
+
+		f, err := os.Open(r.name)
+		if err != nil {
+			events <- platform.MakeError(fmt.Errorf("open record: %w", err))
+			return
+		}
+		defer f.Close()
+
+		dec := json.NewDecoder(bufio.NewReader(f))
+
+		for {
+			var l line
+
+			err := dec.Decode(&l)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				events <- platform.MakeError(fmt.Errorf("decode record: %w", err))
+				return
+			}
+
+			if l.Symbol != symbol {
+				continue
+			}
+
+			e, err := l.event()
+			if err != nil {
+				events <- platform.MakeError(fmt.Errorf("decode record: %w", err))
+				return
+			}
+
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				events <- platform.MakeError(ctx.Err())
+				return
+			}
+		}
+	}()
+
+	return events
+}
@@ -0,0 +1,127 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+// stream serves the events of the subscribed symbol and closes.
+type stream map[platform.Symbol][]platform.EventContainer
+
+func (s stream) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, len(s[symbol]))
+	for _, e := range s[symbol] {
+		events <- e
+	}
+	close(events)
+	return events
+}
+
+func session() stream {
+	price := fixed.NewS("101.25")
+	qty := fixed.NewS("0.5")
+
+	return stream{
+		"BTCUSDT": {
+			platform.MakeCandle(platform.Candle{
+				Time: 60000, Open: price, High: price, Low: price, Close: price, Volume: qty,
+				TimeClose: 119999, VolumeQuote: qty, CountTrades: 3, VolumeTakerBuyBase: qty, VolumeTakerBuyQuote: qty,
+				Partial: true,
+			}),
+			platform.MakeTrade(platform.Trade{TradeID: 7, Time: 60001, Symbol: "BTCUSDT", Price: price, Quantity: qty, IsBuyerMaker: true}),
+			platform.MakeError(errors.New("connection reset")),
+			platform.MakeReconnect(platform.Reconnect{From: 60001, To: 61000, Attempts: 2, Reason: "connection reset", Backfilled: true}),
+			platform.MakeBookTicker(platform.BookTicker{Time: 61000, UpdateID: "42", BestBidPrice: price, BestBidQty: qty, BestAskPrice: price, BestAskQty: qty}),
+			platform.MakeDepth(platform.Depth{
+				Time: 61001, FirstUpdateID: 43, FinalUpdateID: 45,
+				Bids: []platform.PriceLevel{{Price: price, Quantity: qty}},
+				Asks: []platform.PriceLevel{{Price: price, Quantity: fixed.ZERO}},
+			}),
+		},
+		"ETHUSDT": {
+			platform.MakeOrderUpdate(platform.OrderUpdate{
+				Time: 60500, Symbol: "ETHUSDT", OrderID: "1", ClientOrderID: "c1", Execution: "TRADE",
+				Price: price, Quantity: qty, ExecutedQuantity: qty, CummulativeQuoteQuantity: qty,
+				TradeID: 9, LastPrice: price, LastQuantity: qty, Fee: qty, FeeAsset: "BNB", IsMaker: true,
+			}),
+			platform.MakeBalanceUpdate(platform.BalanceUpdate{
+				Time:     60500,
+				Balances: []platform.Balance{{Asset: "ETH", Free: qty, Locked: fixed.ZERO}},
+			}),
+			platform.MakeError(errors.New("listen key expired")),
+		},
+	}
+}
+
+func drain(events <-chan platform.EventContainer) (got []platform.EventContainer) {
+	for e := range events {
+		got = append(got, e)
+	}
+	return got
+}
+
+func TestRecordReplay(t *testing.T) {
+	source := session()
+	name := filepath.Join(t.TempDir(), "session.jsonl")
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := NewRecorder(source, f)
+
+	for _, symbol := range []platform.Symbol{"BTCUSDT", "ETHUSDT"} {
+		// Events are passed through as they are.
+		if got := drain(rec.Subscribe(context.Background(), symbol)); !reflect.DeepEqual(got, source[symbol]) {
+			t.Fatalf("%s passed events = %+v, want %+v", symbol, got, source[symbol])
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewReplay(name)
+
+	for _, symbol := range []platform.Symbol{"BTCUSDT", "ETHUSDT"} {
+		got := drain(replay.Subscribe(context.Background(), symbol))
+		want := source[symbol]
+
+		if len(got) != len(want) {
+			t.Fatalf("%s replayed %d events, want %d", symbol, len(got), len(want))
+		}
+
+		for i := range want {
+			if want[i].Type != platform.EventErr {
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("%s event %d = %+v, want %+v", symbol, i, got[i], want[i])
+				}
+				continue
+			}
+
+			if got[i].Type != platform.EventErr || !errors.Is(got[i].Error, ErrRecorded) {
+				t.Errorf("%s event %d = %+v, want a recorded error", symbol, i, got[i])
+				continue
+			}
+			if want := ErrRecorded.Error() + ": " + want[i].Error.Error(); got[i].Error.Error() != want {
+				t.Errorf("%s error %d = %q, want %q", symbol, i, got[i].Error, want)
+			}
+		}
+	}
+}
+
+func TestReplayMissing(t *testing.T) {
+	got := drain(NewReplay(filepath.Join(t.TempDir(), "missing.jsonl")).Subscribe(context.Background(), "BTCUSDT"))
+
+	if len(got) != 1 || got[0].Type != platform.EventErr || !errors.Is(got[0].Error, os.ErrNotExist) {
+		t.Fatalf("events = %+v, want a not exist error", got)
+	}
+}
@@ -0,0 +1,229 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/history"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+// Kinds of the issues.
+const (
+	IssueGap        = "gap"
+	IssueDuplicate  = "duplicate"
+	IssueOutOfOrder = "out of order"
+	IssueMisaligned = "misaligned"
+	IssueOHLC       = "ohlc"
+)
+
+type Issue struct {
+	Kind string
+	// Time of the candle with the issue.
+	Time int64
+	// Prev is the time of the previous accepted candle.
+	Prev int64
+	// Missing is the number of the candles missed by the gap.
+	Missing int64
+	Message string
+}
+
+func (i Issue) String() string {
+	switch i.Kind {
+	case IssueGap:
+		return fmt.Sprintf("%s: time=%d prev=%d missing=%d", i.Kind, i.Time, i.Prev, i.Missing)
+	case IssueOHLC:
+		return fmt.Sprintf("%s: time=%d: %s", i.Kind, i.Time, i.Message)
+	default:
+		return fmt.Sprintf("%s: time=%d prev=%d", i.Kind, i.Time, i.Prev)
+	}
+}
+
+type Options struct {
+	// Interval between candles in milliseconds.
+	Interval int64
+	// FillGaps inserts flat candles of the previous close into gaps.
+	FillGaps bool
+	// DropDuplicates drops duplicated and out of order candles.
+	DropDuplicates bool
+	// OnIssue is called on every found issue if it is set.
+	OnIssue func(symbol platform.Symbol, issue Issue)
+}
+
+// Validator checks a stream of candles of a single symbol.
+type Validator struct {
+	opt  Options
+	prev platform.Candle
+	seen bool
+}
+
+func New(opt Options) *Validator {
+	return &Validator{
+		opt: opt,
+	}
+}
+
+// Check validates the next candle and returns candles to pass on
+// after repair: the candle itself, preceded by the filled gap if any,
+// or nothing if it is dropped. A candle with the time of the previous
+// partial one is its update and replaces it.
+func (v *Validator) Check(c platform.Candle) (issues []Issue, candles []platform.Candle) {
+	if msg := inconsistency(c); msg != "" {
+		issues = append(issues, Issue{Kind: IssueOHLC, Time: c.Time, Prev: v.prev.Time, Message: msg})
+	}
+
+	if !v.seen {
+		v.seen = true
+		v.prev = c
+		return issues, []platform.Candle{c}
+	}
+
+	var (
+		prev     = v.prev
+		dt       = c.Time - prev.Time
+		interval = v.opt.Interval
+	)
+
+	switch {
+	case dt == 0 && prev.Partial:
+		// An update of the candle in progress.
+
+	case dt == 0:
+		issues = append(issues, Issue{Kind: IssueDuplicate, Time: c.Time, Prev: prev.Time})
+		if v.opt.DropDuplicates {
+			return issues, nil
+		}
+
+	case dt < 0:
+		issues = append(issues, Issue{Kind: IssueOutOfOrder, Time: c.Time, Prev: prev.Time})
+		if v.opt.DropDuplicates {
+			return issues, nil
+		}
+		// Keep checking against the latest candle.
+		return issues, []platform.Candle{c}
+
+	case interval > 0 && dt%interval != 0:
+		issues = append(issues, Issue{Kind: IssueMisaligned, Time: c.Time, Prev: prev.Time})
+
+	case interval > 0 && dt > interval:
+		missing := dt/interval - 1
+		issues = append(issues, Issue{Kind: IssueGap, Time: c.Time, Prev: prev.Time, Missing: missing})
+
+		if v.opt.FillGaps {
+			for t := prev.Time + interval; t < c.Time; t += interval {
+				candles = append(candles, flat(prev, t, interval))
+			}
+		}
+	}
+
+	v.prev = c
+
+	return issues, append(candles, c)
+}
+
+func inconsistency(c platform.Candle) string {
+	switch {
+	case c.High.LessThan(c.Low):
+		return fmt.Sprintf("high=%s is less than low=%s", c.High, c.Low)
+	case c.Open.GreaterThan(c.High) || c.Open.LessThan(c.Low):
+		return fmt.Sprintf("open=%s is out of low=%s high=%s", c.Open, c.Low, c.High)
+	case c.Close.GreaterThan(c.High) || c.Close.LessThan(c.Low):
+		return fmt.Sprintf("close=%s is out of low=%s high=%s", c.Close, c.Low, c.High)
+	case c.Volume.Sign() < 0:
+		return fmt.Sprintf("negative volume=%s", c.Volume)
+	default:
+		return ""
+	}
+}
+
+func flat(prev platform.Candle, t, interval int64) platform.Candle {
+	c := platform.Candle{
+		Time:                t,
+		Open:                prev.Close,
+		High:                prev.Close,
+		Low:                 prev.Close,
+		Close:               prev.Close,
+		Volume:              fixed.ZERO,
+		VolumeQuote:         fixed.ZERO,
+		VolumeTakerBuyBase:  fixed.ZERO,
+		VolumeTakerBuyQuote: fixed.ZERO,
+	}
+	if prev.TimeClose != 0 {
+		c.TimeClose = t + interval - 1
+	}
+	return c
+}
+
+// Scan validates the whole history and returns found issues.
+func Scan(r history.Reader, opt Options) (issues []Issue, err error) {
+	v := New(opt)
+
+	for {
+		t, err := r.Read()
+		if err == io.EOF {
+			return issues, nil
+		}
+		if err != nil {
+			return issues, fmt.Errorf("read history: %w", err)
+		}
+
+		found, _ := v.Check(platform.Candle{
+			Time:   t.Time,
+			Open:   t.Open,
+			High:   t.High,
+			Low:    t.Low,
+			Close:  t.Close,
+			Volume: t.Volume,
+		})
+		issues = append(issues, found...)
+	}
+}
+
+// Provider validates and repairs candles of the wrapped provider,
+// other events are passed as is.
+type Provider struct {
+	public platform.Public
+	opt    Options
+}
+
+var _ platform.Public = &Provider{}
+
+func Wrap(public platform.Public, opt Options) *Provider {
+	return &Provider{
+		public: public,
+		opt:    opt,
+	}
+}
+
+func (p *Provider) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, 1024)
+
+	go func() {
+		defer close(events)
+
+		v := New(p.opt)
+
+		for e := range p.public.Subscribe(ctx, symbol) {
+			if e.Type != platform.EventCandle {
+				events <- e
+				continue
+			}
+
+			issues, candles := v.Check(e.Event.Candle)
+
+			if p.opt.OnIssue != nil {
+				for _, issue := range issues {
+					p.opt.OnIssue(symbol, issue)
+				}
+			}
+
+			for _, c := range candles {
+				events <- platform.MakeCandle(c)
+			}
+		}
+	}()
+
+	return events
+}
@@ -0,0 +1,234 @@
+package validate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/WinPooh32/fixed"
+	"github.com/WinPooh32/retrade/history"
+	"github.com/WinPooh32/retrade/platform"
+)
+
+const minute = 60000
+
+func candle(t int64, close string, partial bool) platform.Candle {
+	price := fixed.NewS(close)
+	return platform.Candle{
+		Time:    t,
+		Open:    price,
+		High:    price,
+		Low:     price,
+		Close:   price,
+		Volume:  fixed.NewI(1, 0),
+		Partial: partial,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	bad := candle(2*minute, "1", false)
+	bad.High = fixed.NewS("0.5")
+
+	tests := []struct {
+		name    string
+		opt     Options
+		candles []platform.Candle
+		issues  []string
+		times   []int64
+	}{
+		{
+			"sequence",
+			Options{Interval: minute},
+			[]platform.Candle{candle(minute, "1", false), candle(2*minute, "2", false), candle(3*minute, "3", false)},
+			nil,
+			[]int64{minute, 2 * minute, 3 * minute},
+		},
+		{
+			"partial updates",
+			Options{Interval: minute, DropDuplicates: true},
+			[]platform.Candle{
+				candle(minute, "1", true),
+				candle(minute, "2", true),
+				candle(minute, "3", false),
+				candle(2*minute, "4", true),
+			},
+			nil,
+			[]int64{minute, minute, minute, 2 * minute},
+		},
+		{
+			"duplicate of closed",
+			Options{Interval: minute},
+			[]platform.Candle{candle(minute, "1", true), candle(minute, "2", false), candle(minute, "3", false)},
+			[]string{IssueDuplicate},
+			[]int64{minute, minute, minute},
+		},
+		{
+			"drop duplicate",
+			Options{Interval: minute, DropDuplicates: true},
+			[]platform.Candle{candle(minute, "1", false), candle(minute, "1", false), candle(2*minute, "2", false)},
+			[]string{IssueDuplicate},
+			[]int64{minute, 2 * minute},
+		},
+		{
+			"out of order",
+			Options{Interval: minute},
+			[]platform.Candle{candle(2*minute, "1", false), candle(minute, "2", false), candle(3*minute, "3", false)},
+			[]string{IssueOutOfOrder},
+			[]int64{2 * minute, minute, 3 * minute},
+		},
+		{
+			"drop out of order",
+			Options{Interval: minute, DropDuplicates: true},
+			[]platform.Candle{candle(2*minute, "1", false), candle(minute, "2", false), candle(3*minute, "3", false)},
+			[]string{IssueOutOfOrder},
+			[]int64{2 * minute, 3 * minute},
+		},
+		{
+			"misaligned",
+			Options{Interval: minute},
+			[]platform.Candle{candle(minute, "1", false), candle(2*minute+1, "2", false)},
+			[]string{IssueMisaligned},
+			[]int64{minute, 2*minute + 1},
+		},
+		{
+			"gap",
+			Options{Interval: minute},
+			[]platform.Candle{candle(minute, "1", false), candle(4*minute, "2", false)},
+			[]string{IssueGap},
+			[]int64{minute, 4 * minute},
+		},
+		{
+			"fill gap",
+			Options{Interval: minute, FillGaps: true},
+			[]platform.Candle{candle(minute, "1", false), candle(4*minute, "2", false)},
+			[]string{IssueGap},
+			[]int64{minute, 2 * minute, 3 * minute, 4 * minute},
+		},
+		{
+			"ohlc",
+			Options{Interval: minute},
+			[]platform.Candle{candle(minute, "1", false), bad},
+			[]string{IssueOHLC},
+			[]int64{minute, 2 * minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.opt)
+
+			var (
+				kinds []string
+				times []int64
+			)
+
+			for _, c := range tt.candles {
+				issues, candles := v.Check(c)
+				for _, issue := range issues {
+					kinds = append(kinds, issue.Kind)
+				}
+				for _, c := range candles {
+					times = append(times, c.Time)
+				}
+			}
+
+			if strings.Join(kinds, ",") != strings.Join(tt.issues, ",") {
+				t.Errorf("issues = %v, want %v", kinds, tt.issues)
+			}
+			if len(times) != len(tt.times) {
+				t.Fatalf("times = %v, want %v", times, tt.times)
+			}
+			for i := range times {
+				if times[i] != tt.times[i] {
+					t.Fatalf("times = %v, want %v", times, tt.times)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckFillGap(t *testing.T) {
+	v := New(Options{Interval: minute, FillGaps: true})
+
+	v.Check(candle(minute, "1.5", false))
+	issues, candles := v.Check(candle(4*minute, "2", false))
+
+	if len(issues) != 1 || issues[0].Missing != 2 || issues[0].Prev != minute {
+		t.Fatalf("issues = %v", issues)
+	}
+	for _, c := range candles[:2] {
+		if !c.Open.Equal(fixed.NewS("1.5")) || !c.Close.Equal(fixed.NewS("1.5")) || !c.Volume.IsZero() {
+			t.Errorf("filled candle = %+v, want flat at the previous close", c)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	const rows = "60,1,2,0.5,1.5,10\n" +
+		"120,1,2,0.5,1.5,10\n" +
+		"120,1,2,0.5,1.5,10\n" +
+		"300,1,2,0.5,1.5,10\n"
+
+	r, err := history.NewReader(strings.NewReader(rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := Scan(r, Options{Interval: minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Issue{
+		{Kind: IssueDuplicate, Time: 2 * minute, Prev: 2 * minute},
+		{Kind: IssueGap, Time: 5 * minute, Prev: 2 * minute, Missing: 2},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("issues = %v, want %v", issues, want)
+	}
+	for i := range want {
+		if issues[i] != want[i] {
+			t.Errorf("issue %d = %v, want %v", i, issues[i], want[i])
+		}
+	}
+}
+
+type candles []platform.Candle
+
+func (cs candles) Subscribe(ctx context.Context, symbol platform.Symbol) <-chan platform.EventContainer {
+	events := make(chan platform.EventContainer, len(cs))
+	for _, c := range cs {
+		events <- platform.MakeCandle(c)
+	}
+	close(events)
+	return events
+}
+
+func TestProviderPartial(t *testing.T) {
+	var issues []Issue
+
+	p := Wrap(candles{
+		candle(minute, "1", true),
+		candle(minute, "2", false),
+		candle(2*minute, "3", true),
+		candle(2*minute, "4", true),
+	}, Options{
+		Interval:       minute,
+		DropDuplicates: true,
+		OnIssue: func(symbol platform.Symbol, issue Issue) {
+			issues = append(issues, issue)
+		},
+	})
+
+	var closes []string
+	for e := range p.Subscribe(context.Background(), "BTCUSDT") {
+		closes = append(closes, e.Event.Candle.Close.String())
+	}
+
+	if len(issues) != 0 {
+		t.Errorf("issues = %v", issues)
+	}
+	if got := strings.Join(closes, ","); got != "1,2,3,4" {
+		t.Errorf("closes = %s, want 1,2,3,4", got)
+	}
+}